@@ -0,0 +1,216 @@
+// Package charset converts XML messages between UTF-8 and the single byte
+// character sets used by legacy channels, ISO-8859-1 and Windows-1256.
+package charset
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Charset is a character set messages can be converted from and to.
+type Charset struct {
+	name   string
+	decode *[128]rune    // runes of bytes 0x80-0xFF, nil for UTF-8
+	encode map[rune]byte // inverse of decode
+}
+
+// Supported character sets. Their ASCII range maps to itself.
+var (
+	UTF8        = &Charset{name: "UTF-8"}
+	ISO88591    = newCharset("ISO-8859-1", &latin1)
+	Windows1256 = newCharset("windows-1256", &windows1256)
+)
+
+// aliases maps lower case charset names to the supported character sets.
+var aliases = map[string]*Charset{
+	"utf-8":        UTF8,
+	"utf8":         UTF8,
+	"iso-8859-1":   ISO88591,
+	"iso8859-1":    ISO88591,
+	"iso_8859-1":   ISO88591,
+	"latin1":       ISO88591,
+	"windows-1256": Windows1256,
+	"cp1256":       Windows1256,
+}
+
+// latin1 maps the upper half of ISO-8859-1, which matches U+0080-U+00FF.
+var latin1 = func() (t [128]rune) {
+	for i := range t {
+		t[i] = rune(0x80 + i)
+	}
+	return t
+}()
+
+// windows1256 maps the upper half of Windows-1256 (Arabic).
+var windows1256 = [128]rune{
+	0x20AC, 0x067E, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, // 0x80
+	0x02C6, 0x2030, 0x0679, 0x2039, 0x0152, 0x0686, 0x0698, 0x0688, // 0x88
+	0x06AF, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, // 0x90
+	0x06A9, 0x2122, 0x0691, 0x203A, 0x0153, 0x200C, 0x200D, 0x06BA, // 0x98
+	0x00A0, 0x060C, 0x00A2, 0x00A3, 0x00A4, 0x00A5, 0x00A6, 0x00A7, // 0xA0
+	0x00A8, 0x00A9, 0x06BE, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF, // 0xA8
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x00B4, 0x00B5, 0x00B6, 0x00B7, // 0xB0
+	0x00B8, 0x00B9, 0x061B, 0x00BB, 0x00BC, 0x00BD, 0x00BE, 0x061F, // 0xB8
+	0x06C1, 0x0621, 0x0622, 0x0623, 0x0624, 0x0625, 0x0626, 0x0627, // 0xC0
+	0x0628, 0x0629, 0x062A, 0x062B, 0x062C, 0x062D, 0x062E, 0x062F, // 0xC8
+	0x0630, 0x0631, 0x0632, 0x0633, 0x0634, 0x0635, 0x0636, 0x00D7, // 0xD0
+	0x0637, 0x0638, 0x0639, 0x063A, 0x0640, 0x0641, 0x0642, 0x0643, // 0xD8
+	0x00E0, 0x0644, 0x00E2, 0x0645, 0x0646, 0x0647, 0x0648, 0x00E7, // 0xE0
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x0649, 0x064A, 0x00EE, 0x00EF, // 0xE8
+	0x064B, 0x064C, 0x064D, 0x064E, 0x00F4, 0x064F, 0x0650, 0x00F7, // 0xF0
+	0x0651, 0x00F9, 0x0652, 0x00FB, 0x00FC, 0x200E, 0x200F, 0x06D2, // 0xF8
+}
+
+// newCharset creates a single byte character set from its upper half table.
+func newCharset(name string, table *[128]rune) *Charset {
+	c := &Charset{name: name, decode: table, encode: make(map[rune]byte, len(table))}
+	for i, r := range table {
+		c.encode[r] = byte(0x80 + i)
+	}
+	return c
+}
+
+// Lookup returns the character set with the given name, ignoring case.
+// An empty name is UTF-8.
+func Lookup(name string) (*Charset, error) {
+	if name == "" {
+		return UTF8, nil
+	}
+	c, ok := aliases[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported charset %q", name)
+	}
+	return c, nil
+}
+
+// Name returns the canonical name of the character set.
+func (c *Charset) Name() string {
+	return c.name
+}
+
+// Decode converts text in the character set to UTF-8.
+func (c *Charset) Decode(b []byte) []byte {
+	if c.decode == nil || isASCII(b) {
+		return b
+	}
+	out := make([]byte, 0, len(b)+len(b)/2)
+	for _, ch := range b {
+		if ch < utf8.RuneSelf {
+			out = append(out, ch)
+			continue
+		}
+		out = utf8.AppendRune(out, c.decode[ch-0x80])
+	}
+	return out
+}
+
+// Encode converts UTF-8 text to the character set. Characters the set
+// cannot represent, and invalid UTF-8, are replaced with '?'.
+func (c *Charset) Encode(b []byte) []byte {
+	if c.decode == nil || isASCII(b) {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		switch ch, ok := c.encode[r]; {
+		case r < utf8.RuneSelf:
+			out = append(out, byte(r))
+		case ok:
+			out = append(out, ch)
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// isASCII reports whether b holds only 7-bit characters, which all supported
+// character sets share.
+func isASCII(b []byte) bool {
+	for _, ch := range b {
+		if ch >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Declared returns the encoding named by the XML declaration of msg, or "" when
+// msg has no declaration or the declaration names no encoding.
+func Declared(msg []byte) string {
+	start, end, ok := declaredEncoding(msg)
+	if !ok {
+		return ""
+	}
+	return string(msg[start:end])
+}
+
+// declaredEncoding locates the value of the encoding attribute in the XML declaration.
+func declaredEncoding(msg []byte) (start, end int, ok bool) {
+	if !bytes.HasPrefix(msg, []byte("<?xml")) {
+		return 0, 0, false
+	}
+	declEnd := bytes.Index(msg, []byte("?>"))
+	if declEnd < 0 {
+		return 0, 0, false
+	}
+	decl := msg[:declEnd]
+
+	i := bytes.Index(decl, []byte("encoding"))
+	if i < 0 {
+		return 0, 0, false
+	}
+	rest := bytes.TrimLeft(decl[i+len("encoding"):], " \t\r\n")
+	if len(rest) == 0 || rest[0] != '=' {
+		return 0, 0, false
+	}
+	rest = bytes.TrimLeft(rest[1:], " \t\r\n")
+	if len(rest) == 0 || (rest[0] != '"' && rest[0] != '\'') {
+		return 0, 0, false
+	}
+	quote := rest[0]
+	start = len(decl) - len(rest) + 1
+	n := bytes.IndexByte(msg[start:declEnd], quote)
+	if n < 0 {
+		return 0, 0, false
+	}
+	return start, start + n, true
+}
+
+// ToUTF8 converts an XML message to UTF-8. The encoding of its XML declaration
+// takes precedence over def, and the declaration is rewritten to name UTF-8 so
+// the message can be parsed with encoding/xml. It returns the character set the
+// message was in.
+func ToUTF8(msg []byte, def *Charset) ([]byte, *Charset, error) {
+	c := def
+	if name := Declared(msg); name != "" {
+		declared, err := Lookup(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		c = declared
+	}
+	return rename(c.Decode(msg), UTF8), c, nil
+}
+
+// FromUTF8 converts a UTF-8 XML message to c, updating the encoding named by its
+// XML declaration when present.
+func FromUTF8(msg []byte, c *Charset) []byte {
+	return rename(c.Encode(msg), c)
+}
+
+// rename sets the encoding of the XML declaration of msg, if it names one, to c.
+func rename(msg []byte, c *Charset) []byte {
+	start, end, ok := declaredEncoding(msg)
+	if !ok || string(msg[start:end]) == c.name {
+		return msg
+	}
+	out := make([]byte, 0, len(msg)-(end-start)+len(c.name))
+	out = append(out, msg[:start]...)
+	out = append(out, c.name...)
+	return append(out, msg[end:]...)
+}
@@ -0,0 +1,116 @@
+package charset
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    *Charset
+		wantErr bool
+	}{
+		{"", UTF8, false},
+		{"utf-8", UTF8, false},
+		{"ISO-8859-1", ISO88591, false},
+		{"latin1", ISO88591, false},
+		{"Windows-1256", Windows1256, false},
+		{"cp1256", Windows1256, false},
+		{"koi8-r", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Lookup(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset *Charset
+		raw     []byte
+		utf     string
+	}{
+		{"ascii", Windows1256, []byte("IVAN"), "IVAN"},
+		{"latin1", ISO88591, []byte("Jos\xe9 M\xfcller"), "José Müller"},
+		{"arabic", Windows1256, []byte("\xe3\xcd\xe3\xcf"), "محمد"},
+		{"arabic and french", Windows1256, []byte("\xda\xe1\xc7\xc1 \xe9t\xe9"), "علاء été"},
+		{"utf-8", UTF8, []byte("علاء"), "علاء"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.charset.Decode(tt.raw); string(got) != tt.utf {
+				t.Errorf("Decode() = %q, want %q", got, tt.utf)
+			}
+			if got := tt.charset.Encode([]byte(tt.utf)); !bytes.Equal(got, tt.raw) {
+				t.Errorf("Encode() = %q, want %q", got, tt.raw)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range []*Charset{ISO88591, Windows1256} {
+		raw := make([]byte, 256)
+		for i := range raw {
+			raw[i] = byte(i)
+		}
+		if got := c.Encode(c.Decode(raw)); !bytes.Equal(got, raw) {
+			t.Errorf("%s: Encode(Decode()) = %q, want all bytes", c.Name(), got)
+		}
+	}
+}
+
+func TestEncodeUnmappable(t *testing.T) {
+	if got := ISO88591.Encode([]byte("A محمد \xff")); string(got) != "A ???? ?" {
+		t.Errorf("Encode() = %q, want %q", got, "A ???? ?")
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         string
+		def         *Charset
+		want        string
+		wantCharset *Charset
+		wantErr     bool
+	}{
+		{"default", "<XML><Name>\xe3\xcd\xe3\xcf</Name></XML>", Windows1256,
+			"<XML><Name>محمد</Name></XML>", Windows1256, false},
+		{"declared", `<?xml version="1.0" encoding="ISO-8859-1"?><XML><Name>Jos` + "\xe9" + `</Name></XML>`, Windows1256,
+			`<?xml version="1.0" encoding="UTF-8"?><XML><Name>José</Name></XML>`, ISO88591, false},
+		{"single quotes", `<?xml version='1.0' encoding='windows-1256'?><XML>` + "\xe3" + `</XML>`, UTF8,
+			`<?xml version='1.0' encoding='UTF-8'?><XML>م</XML>`, Windows1256, false},
+		{"no encoding", `<?xml version="1.0"?><XML>` + "\xe9" + `</XML>`, ISO88591,
+			`<?xml version="1.0"?><XML>é</XML>`, ISO88591, false},
+		{"unsupported", `<?xml version="1.0" encoding="EBCDIC"?><XML/>`, UTF8, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, c, err := ToUTF8([]byte(tt.msg), tt.def)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToUTF8() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want || c != tt.wantCharset {
+				t.Errorf("ToUTF8() = %q, %v, want %q, %v", got, c, tt.want, tt.wantCharset)
+			}
+		})
+	}
+}
+
+func TestFromUTF8(t *testing.T) {
+	msg := `<?xml version="1.0" encoding="UTF-8"?><XML><Name>محمد</Name></XML>`
+	want := `<?xml version="1.0" encoding="windows-1256"?><XML><Name>` + "\xe3\xcd\xe3\xcf" + `</Name></XML>`
+	if got := FromUTF8([]byte(msg), Windows1256); string(got) != want {
+		t.Errorf("FromUTF8() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/queue"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// queueUsage describes the queue administration commands
+const queueUsage = `usage: netfwd -c config.json queue <command>
+
+commands:
+  list [dead]       list the pending or dead-lettered messages
+  show ID           show a message, digits masked
+  requeue ID|all    move dead-lettered messages back for delivery`
+
+// deadLetterUsage describes the dead-letter administration commands
+const deadLetterUsage = `usage: netfwd -c config.json deadletter <command>
+
+commands:
+  list              list the failed requests
+  show ID           show a failed request, digits masked
+  resubmit ID|all   have the running server, whose admin address is given with -m,
+                    process failed requests again and remove them once answered;
+                    requires deadLetter.keepRaw`
+
+// resubmitTimeout bounds the admin request resubmitting a failed request
+const resubmitTimeout = 35 * time.Second
+
+// runCommand runs an administration command given after the flags. admin is the
+// address of the running server's metrics and administration endpoint.
+func runCommand(cfg *config.Config, admin string, args []string, w io.Writer) error {
+	switch args[0] {
+	case "queue":
+		return queueCommand(cfg, args[1:], w)
+	case "deadletter":
+		return deadLetterCommand(cfg, admin, args[1:], w)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// queueCommand inspects and requeues the store and forward queue. It works on
+// the queue directory, so it can run next to the server.
+func queueCommand(cfg *config.Config, args []string, w io.Writer) error {
+	if cfg.StoreForward == nil || cfg.StoreForward.Dir == "" {
+		return errors.New("store and forward is not configured")
+	}
+	if len(args) == 0 {
+		return errors.New(queueUsage)
+	}
+	q, err := queue.Open(cfg.StoreForward.Dir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "list" && len(args) <= 2:
+		area := queue.Pending
+		if len(args) == 2 {
+			if args[1] != queue.Dead {
+				return errors.New(queueUsage)
+			}
+			area = queue.Dead
+		}
+		entries, err := q.List(area)
+		if err != nil {
+			return err
+		}
+		return listEntries(w, entries)
+
+	case args[0] == "show" && len(args) == 2:
+		e, err := q.Get(queue.Pending, args[1])
+		if errors.Is(err, queue.ErrNotFound) {
+			e, err = q.Get(queue.Dead, args[1])
+		}
+		if err != nil {
+			return err
+		}
+		return showEntry(w, e)
+
+	case args[0] == "requeue" && len(args) == 2:
+		ids := []string{args[1]}
+		if args[1] == "all" {
+			dead, err := q.List(queue.Dead)
+			if err != nil {
+				return err
+			}
+			ids = ids[:0]
+			for _, e := range dead {
+				ids = append(ids, e.ID)
+			}
+		}
+		for _, id := range ids {
+			if _, err := q.Requeue(id); err != nil {
+				return fmt.Errorf("requeue %s: %w", id, err)
+			}
+			fmt.Fprintf(w, "requeued %s\n", id)
+		}
+		return nil
+	}
+	return errors.New(queueUsage)
+}
+
+// listEntries prints one line per queued message.
+func listEntries(w io.Writer, entries []*queue.Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tLISTENER\tPROCCODE\tSTAN\tCREATED\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", e.ID, e.Listener, e.ProcCode, e.STAN,
+			e.Created.Format(time.DateTime), e.Attempts, e.NextAttempt.Format(time.DateTime), e.LastError)
+	}
+	return tw.Flush()
+}
+
+// showEntry prints a queued message as JSON with its body masked.
+func showEntry(w io.Writer, e *queue.Entry) error {
+	out := struct {
+		*queue.Entry
+		Body string `json:"body"`
+	}{e, transform.Mask(e.Body)}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(out)
+}
+
+// deadLetterCommand inspects and resubmits the failed requests. Resubmitted
+// requests are processed by the running server, through the admin endpoint.
+func deadLetterCommand(cfg *config.Config, admin string, args []string, w io.Writer) error {
+	if cfg.DeadLetter == nil || cfg.DeadLetter.Dir == "" {
+		return errors.New("dead letters are not configured")
+	}
+	if len(args) == 0 {
+		return errors.New(deadLetterUsage)
+	}
+	store, err := queue.OpenFailures(cfg.DeadLetter.Dir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		entries, err := store.List()
+		if err != nil {
+			return err
+		}
+		return listFailures(w, entries)
+
+	case args[0] == "show" && len(args) == 2:
+		e, err := store.Get(args[1])
+		if err != nil {
+			return err
+		}
+		return showFailure(w, e)
+
+	case args[0] == "resubmit" && len(args) == 2:
+		var entries []*queue.Failure
+		if args[1] == "all" {
+			if entries, err = store.List(); err != nil {
+				return err
+			}
+		} else {
+			e, err := store.Get(args[1])
+			if err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		for _, e := range entries {
+			res, err := resubmit(admin, e.ID)
+			if err != nil {
+				return fmt.Errorf("resubmit %s: %w", e.ID, err)
+			}
+			fmt.Fprintf(w, "resubmitted %s: %s\n", e.ID, res)
+		}
+		return nil
+	}
+	return errors.New(deadLetterUsage)
+}
+
+// resubmit asks the server at the admin address to process a failed request
+// again and returns the masked response.
+func resubmit(admin, id string) (string, error) {
+	if admin == "" {
+		return "", errors.New("the admin address of the running server must be given with -m")
+	}
+	host, port, err := net.SplitHostPort(admin)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(cmp.Or(host, "localhost"), port),
+		Path:   "/deadletters/" + url.PathEscape(id) + "/resubmit",
+	}
+
+	client := http.Client{Timeout: resubmitTimeout}
+	res, err := client.Post(u.String(), "application/json", nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var out struct {
+		Response string `json:"response"`
+		Error    string `json:"error"`
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return "", queue.ErrNotFound
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("invalid admin response, status %s: %w", res.Status, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", errors.New(out.Error)
+	}
+	return out.Response, nil
+}
+
+// listFailures prints one line per failed request.
+func listFailures(w io.Writer, entries []*queue.Failure) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tLISTENER\tROUTE\tPROCCODE\tSTAN\tFAILED\tERROR")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Listener, e.Route, e.ProcCode, e.STAN,
+			e.Failed.Format(time.DateTime), e.Error)
+	}
+	return tw.Flush()
+}
+
+// showFailure prints a failed request as JSON. The raw body is left out; the
+// payload shows it masked.
+func showFailure(w io.Writer, e *queue.Failure) error {
+	out := struct {
+		*queue.Failure
+		Body     []byte `json:"body,omitempty"`
+		Resubmit bool   `json:"resubmittable"`
+	}{Failure: e, Resubmit: e.Body != nil}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(out)
+}
@@ -0,0 +1,369 @@
+// Package config defines the netfwd configuration and loads it from JSON files.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/limit"
+)
+
+// Config holds the complete server configuration.
+// The CLI fills the connection settings from flags and the rest from an optional JSON file.
+type Config struct {
+	Listen  string    `json:"listen"`  // default listener address when Listeners is empty
+	Forward string    `json:"forward"` // default forward upstream address
+	API     APIConfig `json:"api"`
+
+	Cache    CacheConfig    `json:"cache"`
+	Coalesce CoalesceConfig `json:"coalesce"`
+	Limits   LimitsConfig   `json:"limits"`
+	ACL      ACLConfig      `json:"acl"`
+
+	ProxyProtocol ProxyProtocolConfig `json:"proxyProtocol"`
+	Validation    ValidationConfig    `json:"validation"`
+	StoreForward  *StoreForwardConfig `json:"storeForward"` // durable queue for messages that must reach the forward host
+	DeadLetter    *DeadLetterConfig   `json:"deadLetter"`   // store of requests that failed on their route
+	Duplicates    *DuplicateConfig    `json:"duplicates"`   // detection of retransmitted requests
+
+	Listeners []ListenerConfig `json:"listeners"` // defaults to a single listener on Listen
+
+	Middleware []string `json:"middleware"` // ordered message middleware, outermost first
+}
+
+// ListenerConfig describes an inbound listener profile.
+type ListenerConfig struct {
+	Name      string         `json:"name"`
+	Address   string         `json:"address"`   // host:port, or unix:/path for a Unix domain socket
+	Forward   string         `json:"forward"`   // forward upstream, defaults to Config.Forward
+	APIRoutes []string       `json:"apiRoutes"` // ProcCodes routed to the API, defaults to CSNQ
+	Framing   FramingConfig  `json:"framing"`
+	TLS       *TLSConfig     `json:"tls"`
+	ISO8583   *ISO8583Config `json:"iso8583"` // the forward upstream speaks ISO 8583
+	Gateway   *GatewayConfig `json:"gateway"` // accept HTTP/JSON requests instead of framed messages
+
+	Failover  []string         `json:"failover"`  // backup forward upstreams, tried in order when the active one fails
+	Heartbeat *HeartbeatConfig `json:"heartbeat"` // echo messages answered locally and sent to the forward upstream
+
+	// Character sets of the client and forward upstream messages when their XML
+	// declaration names none: UTF-8 (default), ISO-8859-1 or windows-1256
+	Charset        string `json:"charset"`
+	ForwardCharset string `json:"forwardCharset"`
+}
+
+// GatewayConfig describes an HTTP/JSON gateway listener.
+type GatewayConfig struct {
+	PoolSize int      `json:"poolSize"` // idle forward upstream connections kept, defaults to 4
+	Timeout  Duration `json:"timeout"`  // time allowed for the upstream exchange, defaults to 30s
+}
+
+// HeartbeatConfig describes the echo messages keeping sessions alive.
+type HeartbeatConfig struct {
+	ProcCodes   []string `json:"procCodes"`   // client ProcCodes answered locally, e.g. ECHO
+	ActCode     string   `json:"actCode"`     // action code of the local answer, defaults to 0
+	Description string   `json:"description"` // action description of the local answer, defaults to Echo
+
+	// Echo sent to the forward upstream after Interval without forward traffic, 0
+	// disables it. ${STAN} and ${DATETIME} in the template are replaced with a new
+	// STAN and the local time as MMDDhhmmss.
+	Interval Duration `json:"interval"`
+	Template string   `json:"template"`
+	Timeout  Duration `json:"timeout"` // time allowed for the echo answer before failing over, defaults to 10s
+}
+
+// ISO8583Config describes the ISO 8583 dialect of a forward upstream.
+type ISO8583Config struct {
+	Spec      string         `json:"spec"`      // field spec file, defaults to the built-in ISO 8583:1987 spec
+	Translate bool           `json:"translate"` // translate XML channel messages to ISO 8583 and back
+	MTITag    string         `json:"mtiTag"`    // XML tag holding the MTI, defaults to MTI
+	MTI       string         `json:"mti"`       // MTI of requests without the MTI tag, defaults to 0200
+	Fields    map[int]string `json:"fields"`    // ISO field number to XML tag
+}
+
+// Oversized frame policies
+const (
+	OversizeClose  = "close"  // close the connection
+	OversizeSkip   = "skip"   // discard the message and answer with a format error
+	OversizeResync = "resync" // discard the length prefix and scan for the next message
+)
+
+// FramingConfig describes how messages are delimited on the wire.
+type FramingConfig struct {
+	Mode           string `json:"mode"`           // "length" (default), "delimiter" or "xml"
+	Delimiter      string `json:"delimiter"`      // terminator in delimiter mode, e.g. "\u0003" (ETX) or "\n"
+	LengthSize     int    `json:"lengthSize"`     // digits in the ASCII length prefix, defaults to 5
+	MaxSize        int    `json:"maxSize"`        // largest client message body in bytes, defaults to 10MB
+	ForwardMaxSize int    `json:"forwardMaxSize"` // largest forward upstream message body, defaults to 10MB
+	ResyncLimit    int    `json:"resyncLimit"`    // most bytes dropped looking for the next message, defaults to 64KB
+
+	// Framing of the forward upstream, defaulting to the client framing
+	ForwardMode       string `json:"forwardMode"`
+	ForwardDelimiter  string `json:"forwardDelimiter"`
+	ForwardLengthSize int    `json:"forwardLengthSize"`
+
+	Oversize string `json:"oversize"` // policy for client messages over maxSize, defaults to close
+	Resync   bool   `json:"resync"`   // scan for the next message after an invalid length prefix
+
+	// Action code of the format error answering skipped messages, defaults to 30 "Message too large"
+	DeclineCode        string `json:"declineCode"`
+	DeclineDescription string `json:"declineDescription"`
+}
+
+// Store-and-forward acknowledgement rules
+const (
+	AckImmediate = "immediate" // acknowledge once the message is queued, deliver in the background
+	AckOnFailure = "onFailure" // forward the message, queueing and acknowledging it when that fails
+)
+
+// StoreForwardConfig describes the durable queue of messages, such as reversals
+// and advices, that must eventually be delivered to the forward host.
+type StoreForwardConfig struct {
+	Dir          string   `json:"dir"`          // queue directory
+	ProcCodes    []string `json:"procCodes"`    // ProcCodes of queued messages
+	MessageTypes []string `json:"messageTypes"` // MessageType tag values of queued messages
+	Ack          string   `json:"ack"`          // acknowledgement rule, defaults to immediate
+
+	// Action code of the acknowledgement, defaults to 0 "Accepted for delivery"
+	ActCode     string `json:"actCode"`
+	Description string `json:"description"`
+
+	RetryInterval Duration `json:"retryInterval"` // time between delivery attempts, defaults to 30s
+	MaxAttempts   int      `json:"maxAttempts"`   // attempts before a message is dead-lettered, defaults to 10
+	Timeout       Duration `json:"timeout"`       // time allowed for one delivery, defaults to 30s
+}
+
+// DeadLetterConfig describes the store of requests that failed in the API or
+// forward upstream.
+type DeadLetterConfig struct {
+	Dir     string `json:"dir"`     // dead-letter directory
+	KeepRaw bool   `json:"keepRaw"` // also keep the unmasked body, which resubmission requires
+}
+
+// Duplicate request actions
+const (
+	DuplicateReplay = "replay" // answer with the response of the original request
+	DuplicateReject = "reject" // answer with the duplicate action code
+)
+
+// DuplicateConfig describes the detection of requests retransmitted by a
+// switch, e.g. after a timeout.
+type DuplicateConfig struct {
+	Window     Duration `json:"window"`     // time a request is remembered, defaults to 60s
+	KeyFields  []string `json:"keyFields"`  // XML tags identifying a request, defaults to STAN, LocalTxnDtTime and DeliveryChannelCtrlID
+	Action     string   `json:"action"`     // answer to a duplicate, defaults to replay
+	MaxEntries int      `json:"maxEntries"` // 0 means unbounded
+
+	// Action code rejecting duplicates, defaults to 94 "Duplicate transmission"
+	ActCode     string `json:"actCode"`
+	Description string `json:"description"`
+}
+
+// TLSConfig enables TLS on a listener.
+type TLSConfig struct {
+	CertFile     string `json:"certFile"`
+	KeyFile      string `json:"keyFile"`
+	ClientCAFile string `json:"clientCAFile"` // require client certificates signed by this CA
+}
+
+// ProxyProtocolConfig controls PROXY protocol v1/v2 support on the listener.
+type ProxyProtocolConfig struct {
+	Enabled bool     `json:"enabled"`
+	Trusted []string `json:"trusted"` // load balancer networks allowed to send headers, required when enabled
+	Timeout Duration `json:"timeout"` // time allowed to receive the header
+}
+
+// ValidationConfig holds the request validation rules applied before API calls.
+type ValidationConfig struct {
+	Rules              map[string][]FieldRule `json:"rules"`              // per ProcCode
+	DeclineCode        string                 `json:"declineCode"`        // ActCode of the decline XML
+	DeclineDescription string                 `json:"declineDescription"` // ActDescription prefix of the decline XML
+}
+
+// FieldRule constrains the value of one XML tag.
+type FieldRule struct {
+	Field     string   `json:"field"`
+	Required  bool     `json:"required"`
+	MinLength int      `json:"minLength"`
+	MaxLength int      `json:"maxLength"`
+	Pattern   string   `json:"pattern"` // regular expression the whole value must match
+	Allowed   []string `json:"allowed"`
+}
+
+// ACLConfig lists client networks allowed or denied on the listener.
+type ACLConfig struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// LimitsConfig controls rate and concurrency limits.
+type LimitsConfig struct {
+	ClientRate         RateConfig            `json:"clientRate"`         // per client IP
+	ProcCodeRate       map[string]RateConfig `json:"procCodeRate"`       // per ProcCode
+	MaxConnections     int                   `json:"maxConnections"`     // concurrent listener connections, 0 means unlimited
+	ConnectionPolicy   limit.Policy          `json:"connectionPolicy"`   // queue or close
+	MaxAPIRequests     int                   `json:"maxAPIRequests"`     // concurrent requests per API backend, 0 means unlimited
+	APIPolicy          limit.Policy          `json:"apiPolicy"`          // queue, decline or close
+	DeclineCode        string                `json:"declineCode"`        // ActCode of the decline XML
+	DeclineDescription string                `json:"declineDescription"` // ActDescription of the decline XML
+}
+
+// RateConfig is a token bucket rate limit.
+type RateConfig struct {
+	Rate   float64      `json:"rate"`  // messages per second, 0 means unlimited
+	Burst  int          `json:"burst"` // bucket size
+	Policy limit.Policy `json:"policy"`
+}
+
+// Enabled reports whether any limit is configured.
+func (c LimitsConfig) Enabled() bool {
+	return c.ClientRate.Rate > 0 || len(c.ProcCodeRate) > 0 ||
+		c.MaxConnections > 0 || c.MaxAPIRequests > 0
+}
+
+// APIConfig describes the customer HTTP API backend.
+type APIConfig struct {
+	URL      string                 `json:"url"`
+	Username string                 `json:"username"`
+	Password string                 `json:"password"`
+	Routes   map[string]RouteConfig `json:"routes"` // per ProcCode API routes besides CSNQ
+	Results  ResultsConfig          `json:"results"`
+	Paging   PagingConfig           `json:"paging"`
+}
+
+// PagingConfig splits CSNQ responses into pages of at most PageSize records.
+// Clients request further pages by repeating the request with a PageNo tag.
+type PagingConfig struct {
+	PageSize int `json:"pageSize"` // 0 disables paging
+}
+
+// ResultsConfig maps API business outcomes to action codes.
+// Outcomes without a code are answered with ActCode 0.
+type ResultsConfig struct {
+	NotFound    ResultCode         `json:"notFound"`    // empty customer list
+	Blacklisted ResultCode         `json:"blacklisted"` // every customer blacklisted
+	UseMessage  bool               `json:"useMessage"`  // API message field as ActDescription
+	Status      map[int]ResultCode `json:"status"`      // non-200 HTTP status codes
+	DateLayout  string             `json:"dateLayout"`  // Go time layout of record dates, default 20060102
+
+	// CustomerFlags appends GUID, Blacklisted and NationalityWithdrawn to each record
+	CustomerFlags bool `json:"customerFlags"`
+}
+
+// ResultCode is an ActCode and ActDescription pair.
+type ResultCode struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// Route conversion modes
+const (
+	CSNQMode    = "csnq"    // the customer lookup schema
+	GenericMode = "generic" // generic XML to JSON conversion
+)
+
+// RouteConfig describes how messages of a ProcCode are sent to the API.
+type RouteConfig struct {
+	Mode string `json:"mode"` // csnq or generic, defaults to generic
+	URL  string `json:"url"`  // endpoint of the route, defaults to the API URL
+}
+
+// CoalesceConfig controls deduplication of concurrent identical API requests.
+type CoalesceConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// CacheConfig controls the response cache in front of the HTTP API.
+type CacheConfig struct {
+	Enabled     bool                `json:"enabled"`
+	KeyFields   []string            `json:"keyFields"`   // XML tags used to build the cache key
+	MaxEntries  int                 `json:"maxEntries"`  // 0 means unbounded
+	MaxBytes    int                 `json:"maxBytes"`    // 0 means unbounded
+	TTL         Duration            `json:"ttl"`         // default time to live
+	NegativeTTL Duration            `json:"negativeTTL"` // time to live for "not found" results
+	RouteTTL    map[string]Duration `json:"routeTTL"`    // per ProcCode time to live
+	Bypass      []string            `json:"bypass"`      // ProcCodes that are never cached
+}
+
+// Duration is a time.Duration that unmarshals from "30s" style strings or seconds.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		// Accept a plain number of seconds as well
+		secs, err := strconv.ParseFloat(string(b), 64)
+		if err != nil {
+			return fmt.Errorf("invalid duration %s", b)
+		}
+		d.Duration = time.Duration(secs * float64(time.Second))
+		return nil
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Default returns the configuration used when no file is given.
+func Default() *Config {
+	return &Config{
+		Listen:  ":3000",
+		Forward: ":9002",
+		API: APIConfig{
+			URL: "http://localhost:3030/",
+		},
+		Cache: CacheConfig{
+			KeyFields:   []string{"ProcCode", "PName", "PValue"},
+			MaxEntries:  10000,
+			TTL:         Duration{time.Minute},
+			NegativeTTL: Duration{10 * time.Second},
+		},
+		ProxyProtocol: ProxyProtocolConfig{
+			Timeout: Duration{5 * time.Second},
+		},
+		Limits: LimitsConfig{
+			ConnectionPolicy:   limit.Close,
+			APIPolicy:          limit.Decline,
+			DeclineCode:        "91",
+			DeclineDescription: "System busy",
+		},
+		Validation: ValidationConfig{
+			DeclineCode:        "30",
+			DeclineDescription: "Invalid request",
+		},
+		Middleware: []string{"heartbeat", "limits", "logging", "validation", "duplicates", "deadletter", "iso8583", "storeforward"},
+	}
+}
+
+// Load reads a JSON configuration file on top of the defaults.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,201 @@
+// Package framing reads and writes messages delimited on the wire.
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultLengthSize is the size of the standard message length prefix
+const DefaultLengthSize = 5
+
+// DefaultMaxSize is the largest message body accepted when no maximum is set
+const DefaultMaxSize = 10 * 1024 * 1024
+
+// DefaultResyncLimit is the most bytes Resync drops when no limit is set
+const DefaultResyncLimit = 64 * 1024
+
+// maxLengthSize is the longest supported length prefix
+const maxLengthSize = 9
+
+// Framing modes
+const (
+	LengthPrefixed = "length"    // [LengthSize bytes length prefix][message body]
+	Delimited      = "delimiter" // [message body][Delimiter]
+	XMLDocument    = "xml"       // consecutive self-delimiting XML documents
+)
+
+// Framer reads and writes messages delimited on the wire. By default messages
+// carry an ASCII decimal length prefix.
+// The format is: [LengthSize bytes length prefix][message body]
+type Framer struct {
+	Mode        string // LengthPrefixed when empty
+	LengthSize  int
+	MaxSize     int    // largest accepted message body, DefaultMaxSize when 0
+	ResyncLimit int    // most bytes dropped by Resync, DefaultResyncLimit when 0
+	Delimiter   string // terminator of Delimited messages, e.g. "\x03" or "\n"
+}
+
+// Prefixed reports whether messages carry a length prefix.
+func (f Framer) Prefixed() bool {
+	return f.Mode == "" || f.Mode == LengthPrefixed
+}
+
+// Validate checks the framing mode and its settings.
+func (f Framer) Validate() error {
+	switch f.Mode {
+	case "", LengthPrefixed:
+		if f.LengthSize <= 0 || f.LengthSize > maxLengthSize {
+			return fmt.Errorf("length prefix of %d digits is not supported", f.LengthSize)
+		}
+	case Delimited:
+		if f.Delimiter == "" {
+			return errors.New("delimiter framing requires a delimiter")
+		}
+	case XMLDocument:
+	default:
+		return fmt.Errorf("unknown framing mode %q", f.Mode)
+	}
+	return nil
+}
+
+// HeaderError reports a length prefix that is not a positive decimal number.
+type HeaderError struct {
+	Header string
+}
+
+// Error implements error.
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("invalid message length format: %q", e.Header)
+}
+
+// SizeError reports a message over the maximum size.
+type SizeError struct {
+	Length int // announced message length, or the bytes read so far without a prefix
+	Max    int
+}
+
+// Error implements error.
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("message length %d exceeds maximum of %d", e.Length, e.Max)
+}
+
+// Default uses the standard 5 byte length prefix
+var Default = Framer{LengthSize: DefaultLengthSize}
+
+// Read reads a message with the standard 5 byte length prefix
+func Read(r io.Reader) ([]byte, error) {
+	return Default.Read(r)
+}
+
+// Read reads one message, returning it as sent on the wire. A length-prefixed
+// message is read into a single allocation; Reader avoids even that. Messages
+// without a prefix are read byte by byte so nothing past them is consumed;
+// connections carrying many of them should use a Reader.
+func (f Framer) Read(r io.Reader) ([]byte, error) {
+	if !f.Prefixed() {
+		br, ok := r.(io.ByteReader)
+		if !ok {
+			br = &byteReader{r: r}
+		}
+		return f.scan(br, nil)
+	}
+
+	var hdr [maxLengthSize]byte
+	if f.LengthSize > maxLengthSize {
+		return nil, fmt.Errorf("length prefix of %d digits is too long", f.LengthSize)
+	}
+
+	// Read length prefix
+	if _, err := io.ReadFull(r, hdr[:f.LengthSize]); err != nil {
+		return nil, fmt.Errorf("failed to read message length: %w", err)
+	}
+
+	// Parse the length prefix to determine message size
+	length, err := f.parseLength(hdr[:f.LengthSize])
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the actual message body
+	msg := make([]byte, f.LengthSize+length)
+	copy(msg, hdr[:f.LengthSize])
+	if _, err := io.ReadFull(r, msg[f.LengthSize:]); err != nil {
+		return nil, fmt.Errorf("failed to read message body: %w", err)
+	}
+
+	return msg, nil
+}
+
+// parseLength parses and validates an ASCII decimal length prefix.
+// A malformed prefix is reported as a *HeaderError and a length over the
+// maximum as a *SizeError.
+func (f Framer) parseLength(hdr []byte) (int, error) {
+	length := 0
+	for _, c := range hdr {
+		if c < '0' || c > '9' {
+			return 0, &HeaderError{Header: string(hdr)}
+		}
+		length = length*10 + int(c-'0')
+	}
+
+	// Validate message length to prevent potential memory issues
+	if length <= 0 {
+		return 0, &HeaderError{Header: string(hdr)}
+	}
+	if max := f.maxSize(); length > max {
+		return 0, &SizeError{Length: length, Max: max}
+	}
+	return length, nil
+}
+
+// maxSize returns the largest accepted message body.
+func (f Framer) maxSize() int {
+	if f.MaxSize > 0 {
+		return f.MaxSize
+	}
+	return DefaultMaxSize
+}
+
+// resyncLimit returns the most bytes Resync drops.
+func (f Framer) resyncLimit() int {
+	if f.ResyncLimit > 0 {
+		return f.ResyncLimit
+	}
+	return DefaultResyncLimit
+}
+
+// Frame frames a message body for the wire: it prepends the length prefix or
+// appends the delimiter. XML documents are sent as they are.
+func (f Framer) Frame(body []byte) *[]byte {
+	switch f.Mode {
+	case Delimited:
+		msg := make([]byte, 0, len(body)+len(f.Delimiter))
+		msg = append(append(msg, body...), f.Delimiter...)
+		return &msg
+	case XMLDocument:
+		msg := append([]byte(nil), body...)
+		return &msg
+	}
+	msg := make([]byte, 0, f.LengthSize+len(body))
+	msg = fmt.Appendf(msg, "%0*d", f.LengthSize, len(body))
+	msg = append(msg, body...)
+	return &msg
+}
+
+// Body returns the message body of a framed message, without its length prefix
+// or delimiter.
+func (f Framer) Body(msg []byte) []byte {
+	switch f.Mode {
+	case Delimited:
+		return bytes.TrimSuffix(msg, []byte(f.Delimiter))
+	case XMLDocument:
+		return msg
+	}
+	if len(msg) < f.LengthSize {
+		return nil
+	}
+	return msg[f.LengthSize:]
+}
@@ -0,0 +1,249 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestFramer(t *testing.T) {
+	tests := []struct {
+		name    string
+		framer  Framer
+		wire    []byte
+		wantErr bool
+	}{
+		{"5 digit prefix", Framer{LengthSize: 5}, []byte("00005hello"), false},
+		{"4 digit prefix", Framer{LengthSize: 4}, []byte("0005hello"), false},
+		{"invalid prefix", Framer{LengthSize: 5}, []byte("abcdehello"), true},
+		{"short body", Framer{LengthSize: 5}, []byte("00010hello"), true},
+		{"within max size", Framer{LengthSize: 5, MaxSize: 5}, []byte("00005hello"), false},
+		{"over max size", Framer{LengthSize: 5, MaxSize: 4}, []byte("00005hello"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.framer.Read(bytes.NewReader(tt.wire))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !bytes.Equal(got, tt.wire) {
+				t.Errorf("Read() = %q, want %q", got, tt.wire)
+			}
+			if framed := tt.framer.Frame([]byte("hello")); !bytes.Equal(*framed, tt.wire) {
+				t.Errorf("Frame() = %q, want %q", *framed, tt.wire)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	wire := []byte("00005hello00003abc00005wor")
+	r := Default.NewReader(bytes.NewReader(wire))
+
+	for _, want := range []string{"hello", "abc"} {
+		fr, err := r.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame() error = %v", err)
+		}
+		if string(fr.Body) != want || string(fr.Header) != fmt.Sprintf("%05d", len(want)) {
+			t.Errorf("ReadFrame() = %q %q, want body %q", fr.Header, fr.Body, want)
+		}
+		var out bytes.Buffer
+		if _, err := fr.WriteTo(&out); err != nil || out.String() != fmt.Sprintf("%05d%s", len(want), want) {
+			t.Errorf("WriteTo() = %q, %v", out.String(), err)
+		}
+		fr.Release()
+	}
+
+	// A truncated frame is not a clean end of stream
+	if _, err := r.ReadFrame(); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("ReadFrame() of truncated frame error = %v, want unexpected EOF", err)
+	}
+
+	r = Default.NewReader(bytes.NewReader(nil))
+	if _, err := r.ReadFrame(); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadFrame() at end of stream error = %v, want EOF", err)
+	}
+
+	r = Default.NewReader(bytes.NewReader([]byte("0x005hello")))
+	if _, err := r.ReadFrame(); err == nil {
+		t.Error("ReadFrame() with invalid prefix succeeded, want error")
+	}
+}
+
+func TestFrameRetain(t *testing.T) {
+	fr, err := Default.NewReader(bytes.NewReader([]byte("00005hello"))).ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame() error = %v", err)
+	}
+
+	// The frame stays intact until its last holder releases it
+	fr.Retain()
+	fr.Release()
+	if string(fr.Body) != "hello" {
+		t.Fatalf("Body after the first Release() = %q, want %q", fr.Body, "hello")
+	}
+	fr.Release()
+	if fr.Body != nil {
+		t.Errorf("Body after the last Release() = %q, want the frame pooled", fr.Body)
+	}
+}
+
+func TestFramerWrap(t *testing.T) {
+	tests := []struct {
+		name                  string
+		framer                Framer
+		msg                   string
+		header, body, trailer string
+	}{
+		{"length prefixed", Default, "00005hello", "00005", "hello", ""},
+		{"delimited", Framer{Mode: Delimited, Delimiter: "\n"}, "hello\n", "", "hello", "\n"},
+		{"xml document", Framer{Mode: XMLDocument}, "<XML/>", "", "<XML/>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fr := tt.framer.Wrap([]byte(tt.msg))
+			if string(fr.Header) != tt.header || string(fr.Body) != tt.body || string(fr.Trailer) != tt.trailer {
+				t.Errorf("Wrap() = %q %q %q, want %q %q %q", fr.Header, fr.Body, fr.Trailer, tt.header, tt.body, tt.trailer)
+			}
+
+			// Wrapped frames are not pooled
+			fr.Release()
+			if string(fr.Bytes()) != tt.msg {
+				t.Errorf("Bytes() after Release() = %q, want %q", fr.Bytes(), tt.msg)
+			}
+		})
+	}
+}
+
+func TestReaderSizeError(t *testing.T) {
+	f := Framer{LengthSize: 5, MaxSize: 8}
+	if _, err := f.Read(bytes.NewReader([]byte("00010helloworld"))); !errors.As(err, new(*SizeError)) {
+		t.Errorf("Read() error = %v, want *SizeError", err)
+	}
+
+	r := f.NewReader(bytes.NewReader([]byte("00013<XML><A>1</A>00005hello")))
+	_, err := r.ReadFrame()
+	var se *SizeError
+	if !errors.As(err, &se) || se.Length != 13 || se.Max != 8 {
+		t.Fatalf("ReadFrame() error = %v, want *SizeError of length 13", err)
+	}
+
+	head, err := r.Skip(se.Length)
+	if err != nil || string(head) != "<XML><A>1</A>" {
+		t.Fatalf("Skip() = %q, %v, want the skipped body", head, err)
+	}
+	fr, err := r.ReadFrame()
+	if err != nil || string(fr.Body) != "hello" {
+		t.Fatalf("ReadFrame() after Skip = %v, want hello", err)
+	}
+	fr.Release()
+}
+
+func TestReaderResync(t *testing.T) {
+	tests := []struct {
+		name          string
+		wire          string
+		wantErr       error // returned by the first ReadFrame
+		wantSkipped   int
+		wantDiscarded string
+		wantBody      string
+	}{
+		{"oversized prefix", "99999<XML>lost</XML>00011<XML></XML>", &SizeError{},
+			20, "99999<XML>lost</XML>", "<XML></XML>"},
+		{"garbage between frames", "99999junk0012300011<XML></XML>", &SizeError{},
+			14, "99999junk00123", "<XML></XML>"},
+		{"declaration", "99999xx00021<?xml version='1.0'?>", &SizeError{},
+			7, "99999xx", "<?xml version='1.0'?>"},
+		{"corrupt prefix", "\x00\xff00011<XML></XML>", &HeaderError{},
+			2, "\x00\xff", "<XML></XML>"},
+		{"prefix inside garbage", "ab00011<XML></XML>", &HeaderError{},
+			2, "ab", "<XML></XML>"},
+		{"zero length", "00000<XML></XML>00011<XML></XML>", &HeaderError{},
+			16, "00000<XML></XML>", "<XML></XML>"},
+		{"no frame follows", "99999<XML>lost</XML>", &SizeError{},
+			20, "99999<XML>lost</XML>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Framer{LengthSize: 5, MaxSize: 100}.NewReader(bytes.NewReader([]byte(tt.wire)))
+			if _, err := r.ReadFrame(); err == nil || fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tt.wantErr) {
+				t.Fatalf("ReadFrame() error = %v, want %T", err, tt.wantErr)
+			}
+
+			skipped, discarded, err := r.Resync()
+			if skipped != tt.wantSkipped || string(discarded) != tt.wantDiscarded {
+				t.Errorf("Resync() = %d, %q, want %d, %q", skipped, discarded, tt.wantSkipped, tt.wantDiscarded)
+			}
+			if (err != nil) != (tt.wantBody == "") {
+				t.Fatalf("Resync() error = %v", err)
+			}
+			if err != nil {
+				return
+			}
+			fr, err := r.ReadFrame()
+			if err != nil || string(fr.Body) != tt.wantBody {
+				t.Fatalf("ReadFrame() after Resync = %v, want %q", err, tt.wantBody)
+			}
+		})
+	}
+
+	// Only the first bytes dropped are returned
+	r := Default.NewReader(bytes.NewReader(append(bytes.Repeat([]byte("x"), 200), "00003<XML"...)))
+	r.ReadFrame()
+	if skipped, discarded, err := r.Resync(); err != nil || skipped != 200 || len(discarded) != 64 {
+		t.Errorf("Resync() = %d, %d bytes, %v, want 200, 64 bytes", skipped, len(discarded), err)
+	}
+
+	// Scanning stops at the limit
+	f := Framer{LengthSize: 5, ResyncLimit: 100}
+	r = f.NewReader(bytes.NewReader(append(bytes.Repeat([]byte("x"), 200), "00003<XML"...)))
+	r.ReadFrame()
+	if skipped, _, err := r.Resync(); !errors.Is(err, ErrResyncLimit) || skipped != 100 {
+		t.Errorf("Resync() = %d, %v, want 100, %v", skipped, err, ErrResyncLimit)
+	}
+}
+
+// benchmarkStream returns 1000 frames of 1KB bodies.
+func benchmarkStream() []byte {
+	msg := *Default.Frame(bytes.Repeat([]byte("x"), 1024))
+	return bytes.Repeat(msg, 1000)
+}
+
+func BenchmarkFramerRead(b *testing.B) {
+	data := benchmarkStream()
+	r := bytes.NewReader(data)
+	b.ReportAllocs()
+	b.SetBytes(1029)
+	for i := 0; i < b.N; i++ {
+		if r.Len() == 0 {
+			r.Reset(data)
+		}
+		if _, err := Default.Read(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReaderReadFrame(b *testing.B) {
+	data := benchmarkStream()
+	src := bytes.NewReader(data)
+	r := Default.NewReader(src)
+	b.ReportAllocs()
+	b.SetBytes(1029)
+	for i := 0; i < b.N; i++ {
+		if src.Len() == 0 && r.r.Buffered() == 0 {
+			src.Reset(data)
+		}
+		fr, err := r.ReadFrame()
+		if err != nil {
+			b.Fatal(err)
+		}
+		fr.Release()
+	}
+}
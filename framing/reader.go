@@ -0,0 +1,239 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledSize is the largest buffer kept for reuse; larger frames are left
+// to the garbage collector so one big message does not pin its memory.
+const maxPooledSize = 64 * 1024
+
+// framePool holds released frames and their buffers.
+var framePool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 4096)
+		return &Frame{buf: buf, pooled: true}
+	},
+}
+
+// Frame is a message read by a Reader. Header is the length prefix, Body the
+// message and Trailer the delimiter; all share one pooled buffer and are only
+// valid until Release.
+type Frame struct {
+	Header  []byte
+	Body    []byte
+	Trailer []byte
+	buf     []byte
+	pooled  bool
+	refs    atomic.Int32 // holders of a pooled frame
+}
+
+// Wrap returns a frame holding the framed message msg without copying it.
+// The frame is not pooled, so Release leaves msg untouched.
+func (f Framer) Wrap(msg []byte) *Frame {
+	body := f.Body(msg)
+	start := 0
+	if f.Prefixed() && len(msg) >= f.LengthSize {
+		start = f.LengthSize
+	}
+	end := start + len(body)
+	return &Frame{Header: msg[:start], Body: msg[start:end], Trailer: msg[end:], buf: msg}
+}
+
+// Bytes returns the frame as sent on the wire, the header followed by the body
+// and trailer, without copying.
+func (fr *Frame) Bytes() []byte {
+	return fr.buf[:len(fr.Header)+len(fr.Body)+len(fr.Trailer)]
+}
+
+// WriteTo writes the frame as sent on the wire to w.
+func (fr *Frame) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(fr.Bytes())
+	return int64(n), err
+}
+
+// Retain adds a holder of the frame, which releases it in turn, so that the
+// buffer is only reused once every holder is done with it.
+func (fr *Frame) Retain() {
+	fr.refs.Add(1)
+}
+
+// Release returns the frame buffer to the pool once every holder released it.
+// The frame and any slice of it must not be used afterwards.
+func (fr *Frame) Release() {
+	if !fr.pooled || fr.refs.Add(-1) > 0 || cap(fr.buf) > maxPooledSize {
+		return
+	}
+	fr.Header, fr.Body, fr.Trailer = nil, nil, nil
+	framePool.Put(fr)
+}
+
+// Reader reads frames from a connection through a buffered
+// reader, reusing frame buffers released by the caller.
+type Reader struct {
+	f Framer
+	r *bufio.Reader
+}
+
+// NewReader creates a frame reader on r. It may read ahead of the current
+// frame, so r must not be read by anything else.
+func (f Framer) NewReader(r io.Reader) *Reader {
+	return &Reader{f: f, r: bufio.NewReader(r)}
+}
+
+// ReadFrame reads the next frame. The caller releases it when done.
+// A length prefix that is invalid or over the maximum size is left unread,
+// so the caller can Skip the frame or Resync.
+func (r *Reader) ReadFrame() (*Frame, error) {
+	if !r.f.Prefixed() {
+		return r.scanFrame()
+	}
+
+	size := r.f.LengthSize
+	if size > maxLengthSize {
+		return nil, fmt.Errorf("length prefix of %d digits is too long", size)
+	}
+
+	// Parse the prefix in place in the read buffer
+	hdr, err := r.r.Peek(size)
+	if err != nil {
+		if len(hdr) == 0 && err == io.EOF {
+			return nil, fmt.Errorf("failed to read message length: %w", io.EOF)
+		}
+		return nil, fmt.Errorf("failed to read message length: %w", noEOF(err))
+	}
+	length, err := r.f.parseLength(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	fr := framePool.Get().(*Frame)
+	fr.refs.Store(1)
+	if n := size + length; cap(fr.buf) < n {
+		fr.buf = make([]byte, n)
+	} else {
+		fr.buf = fr.buf[:n]
+	}
+	if _, err := io.ReadFull(r.r, fr.buf); err != nil {
+		fr.Release()
+		return nil, fmt.Errorf("failed to read message body: %w", noEOF(err))
+	}
+
+	fr.Header, fr.Body = fr.buf[:size], fr.buf[size:]
+	return fr, nil
+}
+
+// scanFrame reads a frame without a length prefix into a pooled buffer.
+func (r *Reader) scanFrame() (*Frame, error) {
+	fr := framePool.Get().(*Frame)
+	fr.refs.Store(1)
+	buf, err := r.f.scan(r.r, fr.buf[:0])
+	fr.buf = buf
+	if err != nil {
+		fr.Release()
+		return nil, err
+	}
+	fr.Body = buf
+	if r.f.Mode == Delimited {
+		n := len(buf) - len(r.f.Delimiter)
+		fr.Body, fr.Trailer = buf[:n], buf[n:]
+	}
+	return fr, nil
+}
+
+// errNoPrefix reports recovery requested on a stream without length prefixes.
+var errNoPrefix = errors.New("frames without a length prefix cannot be skipped or resynchronized")
+
+// skipHeadSize is how much of a skipped message Skip returns.
+const skipHeadSize = 1024
+
+// Skip discards a frame with the given body length whose length prefix is next
+// in the stream, typically after ReadFrame returned a *SizeError. It returns a
+// copy of the start of the body, enough to identify the message in a reply.
+func (r *Reader) Skip(length int) ([]byte, error) {
+	if !r.f.Prefixed() {
+		return nil, errNoPrefix
+	}
+	if _, err := r.r.Discard(r.f.LengthSize); err != nil {
+		return nil, noEOF(err)
+	}
+	head, err := r.r.Peek(min(length, skipHeadSize))
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	head = append([]byte(nil), head...)
+	if _, err := r.r.Discard(length); err != nil {
+		return nil, noEOF(err)
+	}
+	return head, nil
+}
+
+// frameStarts are the beginnings of a message body that Resync looks for
+// after a plausible length prefix.
+var frameStarts = [][]byte{[]byte("<XML"), []byte("<?xml")}
+
+// maxDiscarded is how many of the bytes dropped by Resync it returns.
+const maxDiscarded = 64
+
+// ErrResyncLimit reports that Resync found no frame within the framer's
+// ResyncLimit.
+var ErrResyncLimit = errors.New("no frame found within the resync limit")
+
+// Resync drops the invalid or oversized length prefix that is next in the
+// stream and scans forward to the next plausible frame: a valid length prefix
+// followed by the start of an XML message. It returns the number of bytes
+// dropped and the first of them, up to 64, for diagnostics. It gives up with
+// ErrResyncLimit once ResyncLimit bytes were dropped.
+func (r *Reader) Resync() (int, []byte, error) {
+	if !r.f.Prefixed() {
+		return 0, nil, errNoPrefix
+	}
+	size, limit := r.f.LengthSize, r.f.resyncLimit()
+	var discarded []byte
+	for skipped := 0; ; skipped++ {
+		b, err := r.r.Peek(size + len("<?xml"))
+		if skipped > 0 && len(b) >= size && r.plausible(b[:size], b[size:]) {
+			return skipped, discarded, nil
+		}
+		if len(b) == 0 {
+			return skipped, discarded, noEOF(err)
+		}
+		if skipped == limit {
+			return skipped, discarded, ErrResyncLimit
+		}
+		if len(discarded) < maxDiscarded {
+			discarded = append(discarded, b[0])
+		}
+		if _, err := r.r.Discard(1); err != nil {
+			return skipped, discarded, noEOF(err)
+		}
+	}
+}
+
+// plausible reports whether hdr is a valid length prefix and body the start
+// of an XML message.
+func (r *Reader) plausible(hdr, body []byte) bool {
+	if _, err := r.f.parseLength(hdr); err != nil {
+		return false
+	}
+	for _, start := range frameStarts {
+		if len(body) >= len(start) && bytes.Equal(body[:len(start)], start) {
+			return true
+		}
+	}
+	return false
+}
+
+// noEOF reports a stream ending inside a frame as truncated rather than closed.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
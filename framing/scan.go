@@ -0,0 +1,202 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// scan reads one message without a length prefix, a delimited message or an
+// XML document, appending it to buf as sent on the wire.
+func (f Framer) scan(br io.ByteReader, buf []byte) ([]byte, error) {
+	s := scanner{br: br, buf: buf, start: len(buf), max: f.maxSize()}
+	var err error
+	if f.Mode == Delimited {
+		err = s.delimited([]byte(f.Delimiter))
+	} else {
+		err = s.document()
+	}
+	if err != nil {
+		return s.buf, fmt.Errorf("failed to read message: %w", err)
+	}
+	return s.buf, nil
+}
+
+// scanner reads a message byte by byte, keeping what it reads.
+type scanner struct {
+	br    io.ByteReader
+	buf   []byte
+	start int // length of buf before the message
+	max   int
+}
+
+// next reads and keeps the next byte of the message.
+func (s *scanner) next() (byte, error) {
+	c, err := s.br.ReadByte()
+	if err != nil {
+		return 0, s.eof(err)
+	}
+	s.buf = append(s.buf, c)
+	if n := len(s.buf) - s.start; n > s.max {
+		return 0, &SizeError{Length: n, Max: s.max}
+	}
+	return c, nil
+}
+
+// eof reports a stream ending inside a message as truncated and one ending
+// between messages as closed.
+func (s *scanner) eof(err error) error {
+	if len(s.buf) > s.start {
+		return noEOF(err)
+	}
+	return err
+}
+
+// until reads up to and including the next occurrence of end.
+func (s *scanner) until(end string) error {
+	last := end[len(end)-1]
+	for {
+		c, err := s.next()
+		if err != nil {
+			return err
+		}
+		if c == last && bytes.HasSuffix(s.buf[s.start:], []byte(end)) {
+			return nil
+		}
+	}
+}
+
+// delimited reads a message terminated by delim. Empty messages, such as blank
+// lines between newline-terminated messages, are skipped.
+func (s *scanner) delimited(delim []byte) error {
+	for {
+		if err := s.until(string(delim)); err != nil {
+			return err
+		}
+		if len(s.buf)-s.start > len(delim) {
+			return nil
+		}
+		s.buf = s.buf[:s.start]
+	}
+}
+
+// document reads an XML document, from its prolog to the end tag of the root
+// element. Whitespace before the document is skipped.
+func (s *scanner) document() error {
+	c, err := s.br.ReadByte()
+	for err == nil && isSpace(c) {
+		c, err = s.br.ReadByte()
+	}
+	if err != nil {
+		return err
+	}
+	if c != '<' {
+		return fmt.Errorf("unexpected %q before XML document", c)
+	}
+	s.buf = append(s.buf, c)
+
+	depth := 0
+	for {
+		// The '<' starting a markup construct has been read
+		c, err := s.next()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case '?':
+			err = s.until("?>")
+		case '!':
+			err = s.declaration()
+		case '/':
+			if err = s.until(">"); err != nil {
+				return err
+			}
+			if depth--; depth < 0 {
+				return errors.New("unexpected end tag before XML document")
+			}
+			if depth == 0 {
+				return nil
+			}
+		default:
+			empty, err := s.tag()
+			if err != nil {
+				return err
+			}
+			if !empty {
+				depth++
+			} else if depth == 0 {
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		// Character data up to the next markup
+		for c != '<' {
+			if c, err = s.next(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// declaration reads a comment, CDATA section or DOCTYPE after "<!".
+// DOCTYPE internal subsets are not supported.
+func (s *scanner) declaration() error {
+	c, err := s.next()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case '-':
+		return s.until("-->")
+	case '[':
+		return s.until("]]>")
+	}
+	return s.until(">")
+}
+
+// tag reads the rest of a start tag, skipping quoted attribute values, and
+// reports whether it is an empty-element tag.
+func (s *scanner) tag() (bool, error) {
+	var quote, prev byte
+	for {
+		c, err := s.next()
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return prev == '/', nil
+		}
+		prev = c
+	}
+}
+
+// isSpace reports whether c is XML whitespace.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// byteReader reads an unbuffered stream one byte at a time, so nothing past
+// the message is consumed.
+type byteReader struct {
+	r io.Reader
+	b [1]byte
+}
+
+// ReadByte implements io.ByteReader.
+func (b *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(b.r, b.b[:]); err != nil {
+		return 0, err
+	}
+	return b.b[0], nil
+}
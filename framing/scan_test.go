@@ -0,0 +1,117 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	etx := Framer{Mode: Delimited, Delimiter: "\x03"}
+	crlf := Framer{Mode: Delimited, Delimiter: "\r\n"}
+	xml := Framer{Mode: XMLDocument}
+
+	tests := []struct {
+		name    string
+		framer  Framer
+		wire    string
+		want    []string // messages as sent on the wire
+		wantEOF bool     // the stream ends cleanly after them
+	}{
+		{"ETX", etx, "<XML>a</XML>\x03<XML>b</XML>\x03",
+			[]string{"<XML>a</XML>\x03", "<XML>b</XML>\x03"}, true},
+		{"multi-byte delimiter", crlf, "one\r\ntwo\rthree\r\n",
+			[]string{"one\r\n", "two\rthree\r\n"}, true},
+		{"empty messages skipped", Framer{Mode: Delimited, Delimiter: "\n"}, "\n\none\n\n",
+			[]string{"one\n"}, true},
+		{"unterminated message", etx, "<XML>a</XML>\x03<XML>",
+			[]string{"<XML>a</XML>\x03"}, false},
+		{"consecutive documents", xml, "<XML><A>1</A></XML><XML><B/></XML>",
+			[]string{"<XML><A>1</A></XML>", "<XML><B/></XML>"}, true},
+		{"whitespace between documents", xml, "\r\n<XML>1</XML>\n\n<XML>2</XML>\n",
+			[]string{"<XML>1</XML>", "<XML>2</XML>"}, true},
+		{"prolog", xml, "<?xml version=\"1.0\"?>\n<!-- channel --><!DOCTYPE XML><XML>1</XML>",
+			[]string{"<?xml version=\"1.0\"?>\n<!-- channel --><!DOCTYPE XML><XML>1</XML>"}, true},
+		{"nested root name", xml, "<XML><XML>in</XML></XML><XML/>",
+			[]string{"<XML><XML>in</XML></XML>", "<XML/>"}, true},
+		{"markup in attributes, comments and CDATA", xml,
+			"<XML a=\"</XML>\" b='/>'><!-- </XML> --><![CDATA[</XML>]]></XML>",
+			[]string{"<XML a=\"</XML>\" b='/>'><!-- </XML> --><![CDATA[</XML>]]></XML>"}, true},
+		{"truncated document", xml, "<XML><A>1</A>",
+			nil, false},
+		{"text before document", xml, "00011<XML></XML>",
+			nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Framer.Read must not read past a message
+			in := bytes.NewReader([]byte(tt.wire))
+			for _, want := range tt.want {
+				got, err := tt.framer.Read(in)
+				if err != nil || string(got) != want {
+					t.Fatalf("Read() = %q, %v, want %q", got, err, want)
+				}
+			}
+			if _, err := tt.framer.Read(in); errors.Is(err, io.EOF) != tt.wantEOF || err == nil {
+				t.Errorf("Read() at end error = %v, want EOF %v", err, tt.wantEOF)
+			}
+
+			r := tt.framer.NewReader(bytes.NewReader([]byte(tt.wire)))
+			for _, want := range tt.want {
+				fr, err := r.ReadFrame()
+				if err != nil || string(fr.Bytes()) != want {
+					t.Fatalf("ReadFrame() = %v, want %q", err, want)
+				}
+				if body := tt.framer.Body(fr.Bytes()); !bytes.Equal(fr.Body, body) {
+					t.Errorf("ReadFrame() Body = %q, want %q", fr.Body, body)
+				}
+				if framed := tt.framer.Frame(fr.Body); string(*framed) != want {
+					t.Errorf("Frame() = %q, want %q", *framed, want)
+				}
+				fr.Release()
+			}
+			if _, err := r.ReadFrame(); errors.Is(err, io.EOF) != tt.wantEOF || err == nil {
+				t.Errorf("ReadFrame() at end error = %v, want EOF %v", err, tt.wantEOF)
+			}
+		})
+	}
+}
+
+func TestScanSizeError(t *testing.T) {
+	for _, f := range []Framer{
+		{Mode: Delimited, Delimiter: "\n", MaxSize: 8},
+		{Mode: XMLDocument, MaxSize: 8},
+	} {
+		r := f.NewReader(bytes.NewReader([]byte("<XML>too long</XML>\n")))
+		if _, err := r.ReadFrame(); !errors.As(err, new(*SizeError)) {
+			t.Errorf("ReadFrame() %s error = %v, want *SizeError", f.Mode, err)
+		}
+		if _, err := r.Skip(10); err == nil {
+			t.Errorf("Skip() %s succeeded, want error", f.Mode)
+		}
+	}
+}
+
+func TestFramerValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		framer  Framer
+		wantErr bool
+	}{
+		{"length", Framer{LengthSize: 5}, false},
+		{"length mode", Framer{Mode: LengthPrefixed, LengthSize: 4}, false},
+		{"long prefix", Framer{LengthSize: 10}, true},
+		{"delimiter", Framer{Mode: Delimited, Delimiter: "\x03"}, false},
+		{"missing delimiter", Framer{Mode: Delimited}, true},
+		{"xml", Framer{Mode: XMLDocument}, false},
+		{"unknown", Framer{Mode: "stx"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.framer.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package iso8583
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields with a meaning to netfwd
+const (
+	ProcCodeField = 3  // processing code, used with the MTI for routing
+	STANField     = 11 // system trace audit number, correlating requests and responses
+)
+
+// Message is an ISO 8583 message. Field values are kept as text;
+// binary fields are hexadecimal.
+type Message struct {
+	MTI    string
+	Fields map[int]string
+}
+
+// NewMessage creates an empty message of the given type.
+func NewMessage(mti string) *Message {
+	return &Message{MTI: mti, Fields: make(map[int]string)}
+}
+
+// Get returns the value of a field, or an empty string if it is absent.
+func (m *Message) Get(n int) string {
+	return m.Fields[n]
+}
+
+// Set sets the value of a field.
+func (m *Message) Set(n int, v string) {
+	m.Fields[n] = v
+}
+
+// STAN returns the system trace audit number of the message.
+func (m *Message) STAN() string {
+	return m.Fields[STANField]
+}
+
+// Pack encodes a message: MTI, primary bitmap, secondary bitmap when a field
+// above 64 is present, then the fields in ascending order.
+func (s *Spec) Pack(m *Message) ([]byte, error) {
+	if len(m.MTI) != 4 || !isDigits(m.MTI) {
+		return nil, fmt.Errorf("invalid MTI %q", m.MTI)
+	}
+
+	numbers := make([]int, 0, len(m.Fields))
+	for n := range m.Fields {
+		if _, ok := s.Fields[n]; !ok {
+			return nil, fmt.Errorf("field %d is not in the spec", n)
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	var bitmap [16]byte
+	secondary := len(numbers) > 0 && numbers[len(numbers)-1] > 64
+	if secondary {
+		bitmap[0] |= 0x80
+	}
+	for _, n := range numbers {
+		bitmap[(n-1)/8] |= 0x80 >> ((n - 1) % 8)
+	}
+	size := 8
+	if secondary {
+		size = 16
+	}
+
+	out := []byte(m.MTI)
+	if s.Bitmap == HexBitmap {
+		out = append(out, strings.ToUpper(hex.EncodeToString(bitmap[:size]))...)
+	} else {
+		out = append(out, bitmap[:size]...)
+	}
+
+	for _, n := range numbers {
+		data, err := s.Fields[n].encode(m.Fields[n])
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", n, err)
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// Unpack decodes a message.
+func (s *Spec) Unpack(data []byte) (*Message, error) {
+	if len(data) < 4 {
+		return nil, errors.New("message too short for MTI")
+	}
+	m := NewMessage(string(data[:4]))
+	pos := 4
+
+	bitmap, n, err := s.readBitmap(data[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+	if bitmap[0]&0x80 != 0 {
+		second, n, err := s.readBitmap(data[pos:])
+		if err != nil {
+			return nil, fmt.Errorf("secondary %w", err)
+		}
+		bitmap = append(bitmap, second...)
+		pos += n
+	}
+
+	for i := 2; i <= len(bitmap)*8; i++ {
+		if bitmap[(i-1)/8]&(0x80>>((i-1)%8)) == 0 {
+			continue
+		}
+		f, ok := s.Fields[i]
+		if !ok {
+			return nil, fmt.Errorf("field %d is not in the spec", i)
+		}
+		v, n, err := f.decode(data[pos:])
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", i, err)
+		}
+		m.Fields[i] = v
+		pos += n
+	}
+
+	if pos != len(data) {
+		return nil, fmt.Errorf("%d unexpected bytes after the last field", len(data)-pos)
+	}
+	return m, nil
+}
+
+// readBitmap reads one 64 bit bitmap, returning it and the bytes consumed.
+func (s *Spec) readBitmap(data []byte) ([]byte, int, error) {
+	if s.Bitmap == HexBitmap {
+		if len(data) < 16 {
+			return nil, 0, errors.New("bitmap truncated")
+		}
+		b, err := hex.DecodeString(string(data[:16]))
+		if err != nil {
+			return nil, 0, fmt.Errorf("bitmap: %w", err)
+		}
+		return b, 16, nil
+	}
+	if len(data) < 8 {
+		return nil, 0, errors.New("bitmap truncated")
+	}
+	return append([]byte(nil), data[:8]...), 8, nil
+}
+
+// encode formats a field value for the wire.
+func (f *FieldSpec) encode(v string) ([]byte, error) {
+	data := []byte(v)
+	if f.Numeric && !f.Binary && !isDigits(v) {
+		return nil, fmt.Errorf("value %q is not numeric", v)
+	}
+	if f.Binary {
+		var err error
+		if data, err = hex.DecodeString(v); err != nil {
+			return nil, fmt.Errorf("invalid hexadecimal value: %w", err)
+		}
+	}
+
+	if f.Type == Fixed {
+		if len(data) > f.Length {
+			return nil, fmt.Errorf("value length %d exceeds %d", len(data), f.Length)
+		}
+		if len(data) < f.Length {
+			if f.Binary {
+				return nil, fmt.Errorf("value length %d, want %d", len(data), f.Length)
+			}
+			if f.Numeric {
+				return []byte(strings.Repeat("0", f.Length-len(data)) + v), nil
+			}
+			return []byte(v + strings.Repeat(" ", f.Length-len(data))), nil
+		}
+		return data, nil
+	}
+
+	if len(data) > f.Length {
+		return nil, fmt.Errorf("value length %d exceeds %d", len(data), f.Length)
+	}
+	out := fmt.Appendf(nil, "%0*d", prefixSize(f.Type), len(data))
+	return append(out, data...), nil
+}
+
+// isDigits reports whether s consists of decimal digits only.
+func isDigits(s string) bool {
+	for i := range len(s) {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// decode reads a field value from the wire, returning it and the bytes consumed.
+func (f *FieldSpec) decode(data []byte) (string, int, error) {
+	length, pos := f.Length, 0
+	if size := prefixSize(f.Type); size > 0 {
+		if len(data) < size {
+			return "", 0, errors.New("length prefix truncated")
+		}
+		n, err := strconv.Atoi(string(data[:size]))
+		if err != nil || n < 0 {
+			return "", 0, fmt.Errorf("invalid length prefix %q", data[:size])
+		}
+		if n > f.Length {
+			return "", 0, fmt.Errorf("length %d exceeds %d", n, f.Length)
+		}
+		length, pos = n, size
+	}
+
+	if len(data) < pos+length {
+		return "", 0, errors.New("value truncated")
+	}
+	value := data[pos : pos+length]
+	if f.Binary {
+		return strings.ToUpper(hex.EncodeToString(value)), pos + length, nil
+	}
+	return string(value), pos + length, nil
+}
@@ -0,0 +1,128 @@
+package iso8583
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackUnpack(t *testing.T) {
+	tests := []struct {
+		name   string
+		bitmap string
+		msg    *Message
+		want   string
+	}{
+		{
+			name:   "primary bitmap",
+			bitmap: BinaryBitmap,
+			msg:    &Message{MTI: "0200", Fields: map[int]string{3: "310000", 11: "000123", 41: "ATM00001"}},
+			want:   "0200\x20\x20\x00\x00\x00\x80\x00\x00" + "310000" + "000123" + "ATM00001",
+		},
+		{
+			name:   "hex bitmap and llvar",
+			bitmap: HexBitmap,
+			msg:    &Message{MTI: "0100", Fields: map[int]string{2: "4111111111111111", 11: "000001"}},
+			want:   "0100" + "4020000000000000" + "164111111111111111" + "000001",
+		},
+		{
+			name:   "secondary bitmap",
+			bitmap: HexBitmap,
+			msg:    &Message{MTI: "0800", Fields: map[int]string{11: "000002", 70: "301"}},
+			want:   "0800" + "8020000000000000" + "0400000000000000" + "000002" + "301",
+		},
+		{
+			name:   "lllvar and binary",
+			bitmap: HexBitmap,
+			msg:    &Message{MTI: "0200", Fields: map[int]string{48: "ABC", 52: "0102030405060708"}},
+			want:   "0200" + "0000000000011000" + "003ABC" + "\x01\x02\x03\x04\x05\x06\x07\x08",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := DefaultSpec()
+			spec.Bitmap = tt.bitmap
+
+			got, err := spec.Pack(tt.msg)
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Pack() = %q, want %q", got, tt.want)
+			}
+
+			back, err := spec.Unpack(got)
+			if err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+			if !reflect.DeepEqual(back, tt.msg) {
+				t.Errorf("Unpack() = %+v, want %+v", back, tt.msg)
+			}
+		})
+	}
+}
+
+func TestPackPadding(t *testing.T) {
+	spec := DefaultSpec()
+	got, err := spec.Pack(&Message{MTI: "0200", Fields: map[int]string{11: "42", 41: "T1"}})
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	m, err := spec.Unpack(got)
+	if err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	if m.STAN() != "000042" {
+		t.Errorf("STAN() = %q, want %q", m.STAN(), "000042")
+	}
+	if m.Get(41) != "T1      " {
+		t.Errorf("Get(41) = %q, want %q", m.Get(41), "T1      ")
+	}
+}
+
+func TestPackErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *Message
+	}{
+		{"invalid MTI", &Message{MTI: "02", Fields: map[int]string{}}},
+		{"MTI not numeric", &Message{MTI: "02A0", Fields: map[int]string{}}},
+		{"fixed numeric with letters", &Message{MTI: "0200", Fields: map[int]string{11: "12A"}}},
+		{"fixed numeric with spaces", &Message{MTI: "0200", Fields: map[int]string{4: " 100"}}},
+		{"field not in spec", &Message{MTI: "0200", Fields: map[int]string{8: "1"}}},
+		{"fixed too long", &Message{MTI: "0200", Fields: map[int]string{11: "1234567"}}},
+		{"llvar too long", &Message{MTI: "0200", Fields: map[int]string{2: "12345678901234567890"}}},
+		{"binary not hex", &Message{MTI: "0200", Fields: map[int]string{52: "zz"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DefaultSpec().Pack(tt.msg); err == nil {
+				t.Error("Pack() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"too short", "02"},
+		{"bitmap truncated", "0200\x20"},
+		{"field truncated", "0200\x00\x20\x00\x00\x00\x00\x00\x00" + "123"},
+		{"field not in spec", "0200\x01\x00\x00\x00\x00\x00\x00\x00" + "1"},
+		{"invalid length prefix", "0200\x40\x00\x00\x00\x00\x00\x00\x00" + "x1"},
+		{"trailing bytes", "0200\x00\x20\x00\x00\x00\x00\x00\x00" + "000001extra"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DefaultSpec().Unpack([]byte(tt.data)); err == nil {
+				t.Error("Unpack() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// Package iso8583 packs and unpacks ISO 8583 messages described by a field spec,
+// and translates them to and from the XML channel format.
+package iso8583
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Field length types
+const (
+	Fixed  = "fixed"  // fixed length
+	LLVar  = "llvar"  // variable length with a 2 digit length prefix
+	LLLVar = "lllvar" // variable length with a 3 digit length prefix
+)
+
+// Bitmap encodings
+const (
+	BinaryBitmap = "binary" // 8 raw bytes per bitmap
+	HexBitmap    = "hex"    // 16 hexadecimal characters per bitmap
+)
+
+// FieldSpec describes one data element.
+type FieldSpec struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`    // fixed, llvar or lllvar
+	Length  int    `json:"length"`  // exact length of fixed fields, maximum length of variable ones
+	Numeric bool   `json:"numeric"` // digits only; fixed numeric fields are left padded with zeros, others right padded with spaces
+	Binary  bool   `json:"binary"`  // raw bytes on the wire, hexadecimal in messages
+}
+
+// Spec describes the fields of an ISO 8583 dialect. Lengths, MTI and
+// field data are ASCII encoded.
+type Spec struct {
+	Bitmap string             `json:"bitmap"` // binary or hex, defaults to binary
+	Fields map[int]*FieldSpec `json:"fields"` // keyed by field number 2 to 128
+}
+
+// LoadSpec reads a JSON field spec file.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ISO 8583 spec: %w", err)
+	}
+
+	var s Spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse ISO 8583 spec: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// validate checks the spec and fills in defaults.
+func (s *Spec) validate() error {
+	switch s.Bitmap {
+	case "":
+		s.Bitmap = BinaryBitmap
+	case BinaryBitmap, HexBitmap:
+	default:
+		return fmt.Errorf("unknown bitmap encoding %q", s.Bitmap)
+	}
+
+	for n, f := range s.Fields {
+		if n < 2 || n > 128 {
+			return fmt.Errorf("field %d: number out of range", n)
+		}
+		if f == nil {
+			return fmt.Errorf("field %d: spec is missing", n)
+		}
+		if f.Length <= 0 {
+			return fmt.Errorf("field %d: length is required", n)
+		}
+		switch f.Type {
+		case Fixed:
+		case LLVar:
+			if f.Length > 99 {
+				return fmt.Errorf("field %d: llvar length exceeds 99", n)
+			}
+		case LLLVar:
+			if f.Length > 999 {
+				return fmt.Errorf("field %d: lllvar length exceeds 999", n)
+			}
+		default:
+			return fmt.Errorf("field %d: unknown type %q", n, f.Type)
+		}
+	}
+	return nil
+}
+
+// DefaultSpec returns an ASCII spec of the common ISO 8583:1987 data elements.
+func DefaultSpec() *Spec {
+	fixed := func(name string, length int, numeric bool) *FieldSpec {
+		return &FieldSpec{Name: name, Type: Fixed, Length: length, Numeric: numeric}
+	}
+	llvar := func(name string, length int) *FieldSpec {
+		return &FieldSpec{Name: name, Type: LLVar, Length: length}
+	}
+	lllvar := func(name string, length int) *FieldSpec {
+		return &FieldSpec{Name: name, Type: LLLVar, Length: length}
+	}
+	binary := func(name string, length int) *FieldSpec {
+		return &FieldSpec{Name: name, Type: Fixed, Length: length, Binary: true}
+	}
+
+	s := &Spec{
+		Bitmap: BinaryBitmap,
+		Fields: map[int]*FieldSpec{
+			2:   llvar("Primary account number", 19),
+			3:   fixed("Processing code", 6, true),
+			4:   fixed("Amount, transaction", 12, true),
+			5:   fixed("Amount, settlement", 12, true),
+			6:   fixed("Amount, cardholder billing", 12, true),
+			7:   fixed("Transmission date and time", 10, true),
+			9:   fixed("Conversion rate, settlement", 8, true),
+			10:  fixed("Conversion rate, cardholder billing", 8, true),
+			11:  fixed("System trace audit number", 6, true),
+			12:  fixed("Time, local transaction", 6, true),
+			13:  fixed("Date, local transaction", 4, true),
+			14:  fixed("Date, expiration", 4, true),
+			15:  fixed("Date, settlement", 4, true),
+			18:  fixed("Merchant type", 4, true),
+			19:  fixed("Acquiring institution country code", 3, true),
+			22:  fixed("Point of service entry mode", 3, true),
+			23:  fixed("Card sequence number", 3, true),
+			25:  fixed("Point of service condition code", 2, true),
+			26:  fixed("Point of service PIN capture code", 2, true),
+			28:  fixed("Amount, transaction fee", 9, false),
+			32:  llvar("Acquiring institution identification code", 11),
+			33:  llvar("Forwarding institution identification code", 11),
+			35:  llvar("Track 2 data", 37),
+			37:  fixed("Retrieval reference number", 12, false),
+			38:  fixed("Authorization identification response", 6, false),
+			39:  fixed("Response code", 2, false),
+			41:  fixed("Card acceptor terminal identification", 8, false),
+			42:  fixed("Card acceptor identification code", 15, false),
+			43:  fixed("Card acceptor name/location", 40, false),
+			44:  llvar("Additional response data", 25),
+			45:  llvar("Track 1 data", 76),
+			48:  lllvar("Additional data, private", 999),
+			49:  fixed("Currency code, transaction", 3, false),
+			50:  fixed("Currency code, settlement", 3, false),
+			51:  fixed("Currency code, cardholder billing", 3, false),
+			52:  binary("Personal identification number data", 8),
+			53:  fixed("Security related control information", 16, true),
+			54:  lllvar("Additional amounts", 120),
+			55:  lllvar("ICC data", 999),
+			60:  lllvar("Reserved national", 999),
+			61:  lllvar("Reserved private", 999),
+			62:  lllvar("Reserved private", 999),
+			63:  lllvar("Reserved private", 999),
+			64:  binary("Message authentication code", 8),
+			70:  fixed("Network management information code", 3, true),
+			90:  fixed("Original data elements", 42, true),
+			95:  fixed("Replacement amounts", 42, false),
+			100: llvar("Receiving institution identification code", 11),
+			102: llvar("Account identification 1", 28),
+			103: llvar("Account identification 2", 28),
+			120: lllvar("Reserved private", 999),
+			121: lllvar("Reserved private", 999),
+			122: lllvar("Reserved private", 999),
+			123: lllvar("Reserved private", 999),
+			124: lllvar("Reserved private", 999),
+			125: lllvar("Reserved private", 999),
+			126: lllvar("Reserved private", 999),
+			127: lllvar("Reserved private", 999),
+			128: binary("Message authentication code", 8),
+		},
+	}
+	return s
+}
+
+// prefixSize returns the number of length digits of a field type.
+func prefixSize(typ string) int {
+	switch typ {
+	case LLVar:
+		return 2
+	case LLLVar:
+		return 3
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,42 @@
+package iso8583
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"valid", `{"bitmap":"hex","fields":{"11":{"type":"fixed","length":6,"numeric":true},"2":{"type":"llvar","length":19}}}`, false},
+		{"default bitmap", `{"fields":{"11":{"type":"fixed","length":6}}}`, false},
+		{"unknown bitmap", `{"bitmap":"ebcdic","fields":{}}`, true},
+		{"unknown type", `{"fields":{"11":{"type":"bcd","length":6}}}`, true},
+		{"missing length", `{"fields":{"11":{"type":"fixed"}}}`, true},
+		{"null field", `{"fields":{"11":null}}`, true},
+		{"field out of range", `{"fields":{"1":{"type":"fixed","length":8}}}`, true},
+		{"llvar too long", `{"fields":{"2":{"type":"llvar","length":100}}}`, true},
+		{"invalid JSON", `{`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "spec.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			spec, err := LoadSpec(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && spec.Bitmap == "" {
+				t.Error("LoadSpec() left the bitmap encoding empty")
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package iso8583
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Translator converts messages between the XML channel format and ISO 8583.
+// Only the mapped fields are translated.
+type Translator struct {
+	Spec   *Spec
+	MTITag string         // XML tag holding the MTI
+	MTI    string         // MTI of requests without the MTI tag
+	Fields map[int]string // ISO field number to XML tag
+}
+
+// ToISO packs the mapped tags of an XML message into an ISO 8583 message.
+func (t *Translator) ToISO(body []byte) ([]byte, error) {
+	tags, err := flatTags(body)
+	if err != nil {
+		return nil, err
+	}
+
+	mti := tags[t.MTITag]
+	if mti == "" {
+		mti = t.MTI
+	}
+	m := NewMessage(mti)
+	for n, tag := range t.Fields {
+		if v, ok := tags[tag]; ok {
+			m.Set(n, v)
+		}
+	}
+	return t.Spec.Pack(m)
+}
+
+// ToXML unpacks an ISO 8583 message into an XML message with the MTI tag
+// first and the mapped fields in ascending field order.
+func (t *Translator) ToXML(data []byte) ([]byte, error) {
+	m, err := t.Spec.Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]int, 0, len(m.Fields))
+	for n := range m.Fields {
+		if _, ok := t.Fields[n]; ok {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	var buf bytes.Buffer
+	buf.WriteString("<XML>")
+	writeTag(&buf, t.MTITag, m.MTI)
+	for _, n := range numbers {
+		writeTag(&buf, t.Fields[n], m.Fields[n])
+	}
+	buf.WriteString("</XML>")
+	return buf.Bytes(), nil
+}
+
+// writeTag writes an element with escaped text.
+func writeTag(buf *bytes.Buffer, tag, value string) {
+	buf.WriteString("<" + tag + ">")
+	xml.EscapeText(buf, []byte(value))
+	buf.WriteString("</" + tag + ">")
+}
+
+// flatTags returns the text of the child elements of the XML root element.
+func flatTags(body []byte) (map[string]string, error) {
+	tags := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(body))
+
+	depth := 0
+	var current string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML message: %w", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				current = tok.Name.Local
+				text.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				text.Write(tok)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				tags[current] = strings.TrimSpace(text.String())
+			}
+			depth--
+		}
+	}
+
+	if len(tags) == 0 {
+		return nil, errors.New("XML message has no fields")
+	}
+	return tags, nil
+}
@@ -0,0 +1,61 @@
+package iso8583
+
+import (
+	"testing"
+)
+
+func TestTranslator(t *testing.T) {
+	tr := &Translator{
+		Spec:   DefaultSpec(),
+		MTITag: "MTI",
+		MTI:    "0200",
+		Fields: map[int]string{11: "STAN", 37: "REFNUM", 39: "ActCode"},
+	}
+
+	req := []byte(`<XML><ProcCode>CRNQ</ProcCode><STAN>123</STAN><REFNUM>R1</REFNUM></XML>`)
+	iso, err := tr.ToISO(req)
+	if err != nil {
+		t.Fatalf("ToISO() error = %v", err)
+	}
+
+	m, err := tr.Spec.Unpack(iso)
+	if err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	if m.MTI != "0200" || m.STAN() != "000123" || m.Get(37) != "R1          " {
+		t.Errorf("ToISO() = %+v, want MTI 0200, STAN 000123, REFNUM R1", m)
+	}
+
+	// Answer with a response MTI and code
+	m.MTI = "0210"
+	m.Set(39, "00")
+	res, err := tr.Spec.Pack(m)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	got, err := tr.ToXML(res)
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+	want := `<XML><MTI>0210</MTI><STAN>000123</STAN><REFNUM>R1          </REFNUM><ActCode>00</ActCode></XML>`
+	if string(got) != want {
+		t.Errorf("ToXML() = %s, want %s", got, want)
+	}
+}
+
+func TestTranslatorMTITag(t *testing.T) {
+	tr := &Translator{Spec: DefaultSpec(), MTITag: "MTI", MTI: "0200", Fields: map[int]string{11: "STAN"}}
+
+	iso, err := tr.ToISO([]byte(`<XML><MTI>0420</MTI><STAN>7</STAN></XML>`))
+	if err != nil {
+		t.Fatalf("ToISO() error = %v", err)
+	}
+	if got := string(iso[:4]); got != "0420" {
+		t.Errorf("ToISO() MTI = %s, want 0420", got)
+	}
+
+	if _, err := tr.ToISO([]byte(`not xml`)); err == nil {
+		t.Error("ToISO() with invalid XML error = nil, want error")
+	}
+}
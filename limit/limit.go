@@ -0,0 +1,150 @@
+// Package limit provides token bucket rate limiting and concurrency semaphores.
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Policy decides what happens to traffic exceeding a limit
+type Policy string
+
+// Over-limit policies
+const (
+	Queue   Policy = "queue"   // wait until capacity is available
+	Decline Policy = "decline" // answer with a decline XML message
+	Close   Policy = "close"   // close the client connection
+)
+
+// ErrOverLimit is returned when a limit is exceeded and the request cannot be queued
+var ErrOverLimit = errors.New("limit exceeded")
+
+// Error reports an exceeded limit together with the policy to apply
+type Error struct {
+	Policy Policy
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s, policy %s", ErrOverLimit, e.Policy)
+}
+
+func (e *Error) Unwrap() error {
+	return ErrOverLimit
+}
+
+// TokenBucket is a classic token bucket refilled continuously at rate tokens per second.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time // last refill
+	used   time.Time // last token taken
+}
+
+// NewTokenBucket creates a full bucket.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = 1
+	}
+	now := time.Now()
+	return &TokenBucket{rate: rate, burst: b, tokens: b, last: now, used: now}
+}
+
+// refill adds the tokens accumulated since the last call; the caller must hold the lock.
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Allow takes a token if one is available.
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	b.used = now
+	return true
+}
+
+// Wait reserves a token and blocks until it becomes available. The token is
+// given back when ctx ends first.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.refill(now)
+	b.tokens--
+	b.used = now
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// Give back the token reserved above
+		b.mu.Lock()
+		b.tokens = min(b.tokens+1, b.burst)
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Idle reports whether the bucket is full and unused for the given duration.
+func (b *TokenBucket) Idle(now time.Time, d time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return now.Sub(b.used) > d && b.tokens >= b.burst
+}
+
+// Semaphore bounds concurrency
+type Semaphore chan struct{}
+
+// NewSemaphore creates a semaphore with n slots.
+func NewSemaphore(n int) Semaphore {
+	return make(Semaphore, n)
+}
+
+// TryAcquire takes a slot without blocking.
+func (s Semaphore) TryAcquire() bool {
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Acquire waits for a slot.
+func (s Semaphore) Acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot.
+func (s Semaphore) Release() {
+	<-s
+}
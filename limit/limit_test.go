@@ -0,0 +1,94 @@
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := NewTokenBucket(100, 2)
+
+	if !b.Allow() || !b.Allow() {
+		t.Fatalf("Allow() expected burst of 2 to pass")
+	}
+	if b.Allow() {
+		t.Errorf("Allow() expected empty bucket to refuse")
+	}
+
+	start := time.Now()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if time.Since(start) < 5*time.Millisecond {
+		t.Errorf("Wait() returned without waiting for a token")
+	}
+}
+
+func TestTokenBucketWaitCanceled(t *testing.T) {
+	b := NewTokenBucket(1, 1)
+	if !b.Allow() {
+		t.Fatalf("Allow() expected the burst to pass")
+	}
+
+	// Waiters giving up must not push the next token further away
+	for range 5 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		if err := b.Wait(ctx); err == nil {
+			t.Fatalf("Wait() succeeded before a token was available")
+		}
+		cancel()
+	}
+	b.mu.Lock()
+	tokens := b.tokens
+	b.mu.Unlock()
+	if tokens < -0.5 {
+		t.Errorf("tokens after canceled waits = %.2f, want the reservations given back", tokens)
+	}
+}
+
+func TestTokenBucketIdle(t *testing.T) {
+	b := NewTokenBucket(10, 2)
+	for b.Allow() {
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"drained", now, false},
+		{"partly refilled", now.Add(150 * time.Millisecond), false},
+		{"refilled", now.Add(time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.Idle(tt.now, 500*time.Millisecond); got != tt.want {
+				t.Errorf("Idle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	s := NewSemaphore(1)
+
+	if !s.TryAcquire() {
+		t.Fatalf("TryAcquire() expected first slot to be free")
+	}
+	if s.TryAcquire() {
+		t.Errorf("TryAcquire() expected semaphore to be full")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx); err == nil {
+		t.Errorf("Acquire() expected timeout on full semaphore")
+	}
+
+	s.Release()
+	if !s.TryAcquire() {
+		t.Errorf("TryAcquire() expected slot after release")
+	}
+}
@@ -2,31 +2,27 @@ package main
 
 import (
 	"context"
-	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
-	"net"
-	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
-)
 
-// Application-wide constants
-const (
-	lengthSize = 5 // Size of message length prefix
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/server"
 )
 
 // Command line flags
 var (
-	DestURL     *url.URL
 	ListenAddr  = flag.String("l", ":3000", "address to listen to")
 	DestPtr     = flag.String("d", "http://localhost:3030/", "HTTP destination endpoint")
 	Username    = flag.String("u", "ecms", "user name, mandatory")
 	Password    = flag.String("s", "ecms1", "user password, mandatory")
 	ForwardAddr = flag.String("f", ":9002", "address to passthrough")
+	ConfigPath  = flag.String("c", "", "path to JSON configuration file")
+	MetricsAddr = flag.String("m", "", "address to serve metrics on, disabled if empty")
 )
 
 func main() {
@@ -44,57 +40,87 @@ func main() {
 
 	flag.Parse()
 
-	if err := checkInit(); err != nil {
+	cfg, err := loadConfig()
+	if err != nil {
 		slog.Error("Initialization error", "error", err)
 		os.Exit(1)
 	}
 
-	l, err := net.Listen("tcp", *ListenAddr)
+	// Administration commands given after the flags run instead of the server
+	if flag.NArg() > 0 {
+		if err := runCommand(cfg, *MetricsAddr, flag.Args(), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	srv, err := server.New(cfg)
 	if err != nil {
-		slog.Error("Failed to listen", "address", *ListenAddr, "error", err)
+		slog.Error("Initialization error", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("Listening", "host", *ListenAddr)
 
-	go Accepter(ctx, l)
-
-	// Handle graceful shutdown
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
-
-	s := <-interrupt
-	slog.Info("Received signal", "signal", s.String())
-	cancel()
-	time.Sleep(time.Second) // Allow time for cleanup
-}
+	if *MetricsAddr != "" {
+		metrics.Handle("/", srv.AdminHandler())
+		go metrics.Serve(*MetricsAddr)
+	}
 
-// checkInit validates command line arguments and initializes global variables
-func checkInit() error {
-	// Check mandatory fields
-	if *Username == "" || *Password == "" {
-		return errors.New("username and password must be provided")
+	if err := srv.Start(ctx); err != nil {
+		slog.Error("Failed to start", "error", err)
+		os.Exit(1)
 	}
 
-	if *DestPtr == "" {
-		return errors.New("destination HTTP endpoint is required")
+	// Handle graceful shutdown and configuration reloads
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	for s := range interrupt {
+		slog.Info("Received signal", "signal", s.String())
+		if s == syscall.SIGHUP {
+			if err := reloadConfig(srv); err != nil {
+				slog.Error("Configuration reload failed", "error", err)
+			}
+			continue
+		}
+		break
 	}
+	srv.Stop()
+}
 
-	// Parse and validate destination URL
-	var err error
-	DestURL, err = url.Parse(*DestPtr)
+// loadConfig reads the optional configuration file and applies the command line flags
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(*ConfigPath)
 	if err != nil {
-		return fmt.Errorf("invalid destination URL: %w", err)
+		return nil, err
 	}
 
-	// Validate listen address
-	if _, _, err = net.SplitHostPort(*ListenAddr); err != nil {
-		return fmt.Errorf("incoming listen address is invalid: %w", err)
-	}
+	// Flags given on the command line win; flag defaults only fill settings the file leaves empty
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	applyFlag(set, "l", &cfg.Listen, *ListenAddr)
+	applyFlag(set, "f", &cfg.Forward, *ForwardAddr)
+	applyFlag(set, "d", &cfg.API.URL, *DestPtr)
+	applyFlag(set, "u", &cfg.API.Username, *Username)
+	applyFlag(set, "s", &cfg.API.Password, *Password)
 
-	// Validate forward address
-	if _, _, err = net.SplitHostPort(*ForwardAddr); err != nil {
-		return fmt.Errorf("forward address is invalid: %w", err)
+	return cfg, nil
+}
+
+// applyFlag copies a flag value into a setting if the flag was given or the setting is empty
+func applyFlag(set map[string]bool, name string, setting *string, value string) {
+	if set[name] || *setting == "" {
+		*setting = value
 	}
+}
 
-	return nil
+// reloadConfig re-reads the configuration file and applies the settings
+// that can change at runtime. Other settings require a restart.
+func reloadConfig(srv *server.Server) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	return srv.Reload(cfg)
 }
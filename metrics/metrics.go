@@ -0,0 +1,45 @@
+// Package metrics holds the netfwd counters, published with expvar
+// under the "netfwd" key of /debug/vars.
+package metrics
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+)
+
+// vars holds the application counters
+var vars = expvar.NewMap("netfwd")
+
+// mux serves the metrics and the administration handlers
+var mux = http.NewServeMux()
+
+func init() {
+	mux.Handle("/debug/vars", Handler())
+}
+
+// NewCounter creates a counter and registers it in the application metrics.
+func NewCounter(name string) *expvar.Int {
+	v := new(expvar.Int)
+	vars.Set(name, v)
+	return v
+}
+
+// Handler serves all expvar variables as JSON.
+func Handler() http.Handler {
+	return expvar.Handler()
+}
+
+// Handle registers an administration handler served next to the metrics. It
+// must be called before Serve.
+func Handle(pattern string, h http.Handler) {
+	mux.Handle(pattern, h)
+}
+
+// Serve exposes the metrics and administration handlers over HTTP on the given address.
+func Serve(addr string) {
+	slog.Info("Serving metrics", "address", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		slog.Error("Metrics server stopped", "error", err)
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/routing"
+)
+
+// Logging logs the routing decision and the processing latency of each message.
+func Logging(next Handler) Handler {
+	return func(ctx context.Context, m *Message) (*[]byte, error) {
+		msgID := routing.MessageID(m.Body)
+		start := time.Now()
+
+		if m.Dest == routing.API {
+			slog.Info("Message has process code", "code", m.ProcCode, "routing", m.Dest.String())
+		} else {
+			slog.Info("Message has no recognized API process code, passing through to proxy")
+		}
+
+		response, err := next(ctx, m)
+		if err != nil || response == nil {
+			return response, err
+		}
+
+		latency := time.Since(start)
+		slog.Info("Message processed",
+			"msgID", msgID,
+			"respMsgID", routing.MessageID(*response),
+			"latency", formatLatency(latency),
+			"latencyRaw", latency.String())
+		return response, nil
+	}
+}
+
+// formatLatency formats a latency based on its magnitude for better readability
+func formatLatency(latency time.Duration) string {
+	switch {
+	case latency < time.Microsecond:
+		return fmt.Sprintf("%.2f ns", float64(latency.Nanoseconds()))
+	case latency < time.Millisecond:
+		return fmt.Sprintf("%.2f µs", float64(latency.Nanoseconds())/1000)
+	case latency < time.Second:
+		return fmt.Sprintf("%.2f ms", float64(latency.Nanoseconds())/1000000)
+	default:
+		return fmt.Sprintf("%.2f s", latency.Seconds())
+	}
+}
@@ -0,0 +1,57 @@
+// Package middleware composes the per-message processing pipeline.
+//
+// Each client message passes through a chain of middleware before it reaches
+// the handler that dispatches it to the forward host or the API. Middleware
+// can inspect or rewrite the message, answer it directly, or stop the connection:
+//
+//	func Audit(next middleware.Handler) middleware.Handler {
+//		return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+//			res, err := next(ctx, m)
+//			slog.Info("Audit", "listener", m.Listener, "procCode", m.ProcCode)
+//			return res, err
+//		}
+//	}
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/routing"
+)
+
+// ErrCloseConnection is returned by a handler to close the client connection
+// without sending a response.
+var ErrCloseConnection = errors.New("close connection")
+
+// Message is a client message passing through the pipeline. Body may share a
+// buffer reused for the next message once the handler returns: middleware that
+// keeps it, or returns it as the response, must copy it.
+type Message struct {
+	Body       []byte         // framed message, length prefix included
+	ProcCode   string         // ProcCode tag of the message, empty if absent
+	Dest       Destination    // where the message is dispatched, set by routing and changeable by middleware
+	Listener   string         // name of the listener profile
+	RemoteAddr net.Addr       // client address
+	Framer     framing.Framer // framing of the client connection
+}
+
+// Destination is an alias of routing.Destination so middleware can re-route messages.
+type Destination = routing.Destination
+
+// Handler processes a message and returns the framed response to send to the client.
+// A nil response with a nil error sends nothing.
+type Handler func(ctx context.Context, m *Message) (*[]byte, error)
+
+// Middleware wraps a Handler with additional behavior.
+type Middleware func(next Handler) Handler
+
+// Chain wraps h with the middleware, the first one being the outermost.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
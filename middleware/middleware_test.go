@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, m *Message) (*[]byte, error) {
+				order = append(order, name)
+				return next(ctx, m)
+			}
+		}
+	}
+	final := func(ctx context.Context, m *Message) (*[]byte, error) {
+		order = append(order, "handler")
+		return &m.Body, nil
+	}
+
+	tests := []struct {
+		name string
+		mws  []Middleware
+		want []string
+	}{
+		{"no middleware", nil, []string{"handler"}},
+		{"first is outermost", []Middleware{mark("a"), mark("b")}, []string{"a", "b", "handler"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order = nil
+			res, err := Chain(final, tt.mws...)(context.Background(), &Message{Body: []byte("msg")})
+			if err != nil {
+				t.Fatalf("Chain() error = %v", err)
+			}
+			if string(*res) != "msg" {
+				t.Errorf("Chain() response = %q, want %q", *res, "msg")
+			}
+			if !reflect.DeepEqual(order, tt.want) {
+				t.Errorf("Chain() order = %v, want %v", order, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainShortCircuit(t *testing.T) {
+	reply := []byte("declined")
+	decline := func(next Handler) Handler {
+		return func(ctx context.Context, m *Message) (*[]byte, error) {
+			return &reply, nil
+		}
+	}
+	called := false
+	final := func(ctx context.Context, m *Message) (*[]byte, error) {
+		called = true
+		return nil, nil
+	}
+
+	res, err := Chain(final, decline)(context.Background(), &Message{})
+	if err != nil || string(*res) != "declined" {
+		t.Errorf("Chain() = %q, %v, want %q", *res, err, "declined")
+	}
+	if called {
+		t.Error("Chain() called the handler after a middleware answered")
+	}
+}
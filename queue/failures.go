@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Failure is a request that failed on its route, kept for inspection and
+// resubmission.
+type Failure struct {
+	ID         string `json:"id"`
+	Listener   string `json:"listener"`
+	RemoteAddr string `json:"remoteAddr"`
+	Route      string `json:"route"` // API or forward
+	ProcCode   string `json:"procCode"`
+	STAN       string `json:"stan"`
+	Error      string `json:"error"`
+
+	Received time.Time `json:"received"`
+	Failed   time.Time `json:"failed"`
+
+	Payload string `json:"payload"`        // message body with digits masked
+	Body    []byte `json:"body,omitempty"` // message body for resubmission, omitted when only the masked payload is kept
+}
+
+// Failures is a durable store of failed requests in a directory.
+type Failures struct {
+	dir string
+	ids idGenerator
+}
+
+// OpenFailures opens the failure store in dir, creating it as needed.
+func OpenFailures(dir string) (*Failures, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter directory: %w", err)
+	}
+	return &Failures{dir: dir}, nil
+}
+
+// Put stores a failed request, assigning its ID.
+func (f *Failures) Put(e *Failure) error {
+	e.ID = f.ids.next(time.Now())
+	return writeJSON(f.dir, e.ID, e)
+}
+
+// Get reads a failed request.
+func (f *Failures) Get(id string) (*Failure, error) {
+	var e Failure
+	if err := readJSON(f.path(id), id, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// List returns the failed requests, oldest first.
+func (f *Failures) List() ([]*Failure, error) {
+	ids, err := listIDs(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Failure, 0, len(ids))
+	for _, id := range ids {
+		e, err := f.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			continue // removed meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Remove deletes a failed request, typically once it was resubmitted.
+func (f *Failures) Remove(id string) error {
+	if _, err := f.Get(id); err != nil {
+		return err
+	}
+	if err := os.Remove(f.path(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file of a failed request.
+func (f *Failures) path(id string) string {
+	return filepath.Join(f.dir, id+".json")
+}
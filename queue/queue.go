@@ -0,0 +1,232 @@
+// Package queue keeps messages awaiting delivery in a directory, one JSON file
+// per message, so they survive restarts. Messages that cannot be delivered are
+// moved to a dead-letter area, from which they can be requeued. Failures keeps
+// failed requests the same way for inspection and resubmission.
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Queue areas
+const (
+	Pending = "pending" // messages awaiting delivery
+	Dead    = "dead"    // messages that exhausted their delivery attempts
+)
+
+// ErrNotFound is returned for an entry that is not in the area.
+var ErrNotFound = errors.New("queue entry not found")
+
+// Entry is a queued message and its delivery state.
+type Entry struct {
+	ID       string `json:"id"`
+	Listener string `json:"listener"` // listener the message was received on
+	ProcCode string `json:"procCode"`
+	STAN     string `json:"stan"`
+	Body     []byte `json:"body"` // message body without framing
+
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Queue is a durable message queue in a directory.
+type Queue struct {
+	dir string
+	ids idGenerator
+}
+
+// Open opens the queue in dir, creating its areas as needed.
+func Open(dir string) (*Queue, error) {
+	for _, area := range []string{Pending, Dead} {
+		if err := os.MkdirAll(filepath.Join(dir, area), 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create queue directory: %w", err)
+		}
+	}
+	return &Queue{dir: dir}, nil
+}
+
+// Put stores a new entry for immediate delivery, assigning its ID. It returns
+// once the entry is on disk.
+func (q *Queue) Put(e *Entry) error {
+	now := time.Now()
+	e.ID = q.ids.next(now)
+	e.Created, e.NextAttempt = now, now
+	return q.write(Pending, e)
+}
+
+// idGenerator hands out entry IDs that sort in creation order: the creation
+// time in nanoseconds, moved forward past the last ID when needed.
+type idGenerator struct {
+	mu   sync.Mutex
+	last int64
+}
+
+// next returns a new ID.
+func (g *idGenerator) next(now time.Time) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.last = max(now.UnixNano(), g.last+1)
+	return fmt.Sprintf("%020d", g.last)
+}
+
+// Update rewrites a pending entry after a failed delivery attempt.
+func (q *Queue) Update(e *Entry) error {
+	return q.write(Pending, e)
+}
+
+// Remove deletes a delivered entry.
+func (q *Queue) Remove(id string) error {
+	if err := os.Remove(q.path(Pending, id)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Bury moves a pending entry to the dead-letter area.
+func (q *Queue) Bury(e *Entry) error {
+	if err := q.write(Dead, e); err != nil {
+		return err
+	}
+	return q.Remove(e.ID)
+}
+
+// Requeue moves a dead entry back to the pending area for delivery, resetting
+// its attempts.
+func (q *Queue) Requeue(id string) (*Entry, error) {
+	e, err := q.Get(Dead, id)
+	if err != nil {
+		return nil, err
+	}
+	e.Attempts, e.NextAttempt, e.LastError = 0, time.Now(), ""
+	if err := q.write(Pending, e); err != nil {
+		return nil, err
+	}
+	return e, os.Remove(q.path(Dead, id))
+}
+
+// Get reads an entry from an area.
+func (q *Queue) Get(area, id string) (*Entry, error) {
+	var e Entry
+	if err := readJSON(q.path(area, id), id, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// List returns the entries of an area, oldest first.
+func (q *Queue) List(area string) ([]*Entry, error) {
+	ids, err := listIDs(filepath.Join(q.dir, area))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(ids))
+	for _, id := range ids {
+		e, err := q.Get(area, id)
+		if errors.Is(err, ErrNotFound) {
+			continue // delivered meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// path returns the file of an entry.
+func (q *Queue) path(area, id string) string {
+	return filepath.Join(q.dir, area, id+".json")
+}
+
+// write stores an entry in an area.
+func (q *Queue) write(area string, e *Entry) error {
+	return writeJSON(filepath.Join(q.dir, area), e.ID, e)
+}
+
+// listIDs returns the IDs of the entries in dir in ascending order.
+func listIDs(dir string) ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(names))
+	for i, name := range names {
+		ids[i] = strings.TrimSuffix(filepath.Base(name), ".json")
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// readJSON reads the entry with the given ID from path into v.
+func readJSON(path, id string, v any) error {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return ErrNotFound
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("entry %s: %w", id, err)
+	}
+	return nil
+}
+
+// writeJSON stores the entry with the given ID in dir durably: it is written to
+// a temporary file, synced and renamed into place, so a crash leaves either the
+// old or the new version. Only the owner can read the file.
+func writeJSON(dir, id string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, id+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write entry: %w", err)
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(dir, id+".json"))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write entry: %w", err)
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	for _, stan := range []string{"1", "2", "3"} {
+		if err := q.Put(&Entry{Listener: "atm", ProcCode: "RVSL", STAN: stan, Body: []byte("<XML/>")}); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	// A reopened queue finds the entries in order
+	q, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	pending, err := q.List(Pending)
+	if err != nil || len(pending) != 3 {
+		t.Fatalf("List() = %d entries, %v, want 3", len(pending), err)
+	}
+	for i, want := range []string{"1", "2", "3"} {
+		if pending[i].STAN != want || string(pending[i].Body) != "<XML/>" {
+			t.Errorf("List()[%d] = %+v, want STAN %s", i, pending[i], want)
+		}
+	}
+
+	first, second := pending[0], pending[1]
+	first.Attempts, first.LastError = 1, "connection refused"
+	if err := q.Update(first); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got, err := q.Get(Pending, first.ID); err != nil || got.Attempts != 1 || got.LastError != "connection refused" {
+		t.Errorf("Get() = %+v, %v, want the updated entry", got, err)
+	}
+
+	if err := q.Remove(second.ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := q.Bury(first); err != nil {
+		t.Fatalf("Bury() error = %v", err)
+	}
+	if pending, _ := q.List(Pending); len(pending) != 1 {
+		t.Errorf("List(Pending) = %d entries, want 1", len(pending))
+	}
+	if dead, _ := q.List(Dead); len(dead) != 1 || dead[0].ID != first.ID {
+		t.Errorf("List(Dead) = %v, want the buried entry", dead)
+	}
+
+	e, err := q.Requeue(first.ID)
+	if err != nil || e.Attempts != 0 || e.LastError != "" {
+		t.Fatalf("Requeue() = %+v, %v, want a fresh entry", e, err)
+	}
+	if dead, _ := q.List(Dead); len(dead) != 0 {
+		t.Errorf("List(Dead) after Requeue = %d entries, want 0", len(dead))
+	}
+	if _, err := q.Get(Pending, first.ID); err != nil {
+		t.Errorf("Get() after Requeue error = %v", err)
+	}
+
+	for _, id := range []string{second.ID, "", "../pending/" + first.ID} {
+		if _, err := q.Get(Pending, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want %v", id, err, ErrNotFound)
+		}
+	}
+	if _, err := q.Requeue(second.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Requeue() of unknown entry error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	dir := t.TempDir()
+	f, err := OpenFailures(dir)
+	if err != nil {
+		t.Fatalf("OpenFailures() error = %v", err)
+	}
+
+	for _, stan := range []string{"1", "2"} {
+		e := &Failure{Listener: "atm", Route: "API", ProcCode: "CSNQ", STAN: stan, Error: "status 500",
+			Payload: "<XML><STAN>*</STAN></XML>", Body: []byte("<XML><STAN>" + stan + "</STAN></XML>")}
+		if err := f.Put(e); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	f, err = OpenFailures(dir)
+	if err != nil {
+		t.Fatalf("OpenFailures() error = %v", err)
+	}
+	entries, err := f.List()
+	if err != nil || len(entries) != 2 || entries[0].STAN != "1" || entries[1].STAN != "2" {
+		t.Fatalf("List() = %v, %v, want both failures in order", entries, err)
+	}
+	got, err := f.Get(entries[1].ID)
+	if err != nil || got.Error != "status 500" || string(got.Body) != "<XML><STAN>2</STAN></XML>" {
+		t.Errorf("Get() = %+v, %v, want the second failure", got, err)
+	}
+
+	if err := f.Remove(entries[0].ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := f.Remove(entries[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove() of removed failure error = %v, want %v", err, ErrNotFound)
+	}
+	if entries, _ := f.List(); len(entries) != 1 {
+		t.Errorf("List() after Remove = %d failures, want 1", len(entries))
+	}
+}
@@ -0,0 +1,100 @@
+// Package routing decides where a message is processed based on its content.
+package routing
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"slices"
+)
+
+// Destination is where a message is processed
+type Destination int
+
+// Destinations
+const (
+	Forward Destination = iota // pass through to the forward upstream
+	API                        // transform and send to the HTTP API
+)
+
+// String returns the destination name used in logs.
+func (d Destination) String() string {
+	if d == API {
+		return "API"
+	}
+	return "forward"
+}
+
+// Table is a routing table listing the process codes handled by the API.
+type Table struct {
+	APIRoutes []string
+}
+
+// Route returns the destination of a message and the process code that matched.
+// Messages without a recognized API process code are forwarded.
+func (t Table) Route(msg []byte) (Destination, string) {
+	for _, code := range t.APIRoutes {
+		if idx := bytes.Index(msg, []byte(code)); idx >= 0 {
+			return API, code
+		}
+	}
+	return Forward, ""
+}
+
+// RouteCodes returns the destination of a message whose codes, such as the MTI
+// and processing code of an ISO 8583 message, are already parsed, and the code
+// that matched. Codes must equal an API process code to be routed to the API.
+func (t Table) RouteCodes(codes ...string) (Destination, string) {
+	for _, route := range t.APIRoutes {
+		if slices.Contains(codes, route) {
+			return API, route
+		}
+	}
+	return Forward, ""
+}
+
+// MessageID extracts a unique identifier from the message
+// It looks for the STAN tag in XML messages which serves as a transaction ID
+func MessageID(msg []byte) string {
+	if stan := ExtractTag(msg, "STAN"); stan != "" {
+		return stan
+	}
+
+	// If we can't extract a STAN, use a hash of the message as fallback
+	h := fnv.New32a()
+	h.Write(msg)
+	return fmt.Sprintf("%x", h.Sum32())
+}
+
+// ExtractTag returns the text of the first occurrence of an XML tag in the message
+// without fully parsing it. It returns an empty string if the tag is absent.
+func ExtractTag(msg []byte, tag string) string {
+	// Skip the length prefix (first 5 bytes) if present
+	if len(msg) > 5 {
+		contentStart := 0
+		// Check if the first 5 bytes are numeric (length prefix)
+		isPrefix := true
+		for i := 0; i < 5 && i < len(msg); i++ {
+			if msg[i] < '0' || msg[i] > '9' {
+				isPrefix = false
+				break
+			}
+		}
+		if isPrefix {
+			contentStart = 5
+		}
+
+		// Look for the tag in the message
+		startTag := "<" + tag + ">"
+		endTag := "</" + tag + ">"
+
+		if idx := bytes.Index(msg[contentStart:], []byte(startTag)); idx >= 0 {
+			start := contentStart + idx + len(startTag)
+			if end := bytes.Index(msg[start:], []byte(endTag)); end > 0 {
+				return string(msg[start : start+end])
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,58 @@
+package routing
+
+import "testing"
+
+func TestTableRoute(t *testing.T) {
+	table := Table{APIRoutes: []string{"CSNQ"}}
+
+	tests := []struct {
+		name     string
+		msg      []byte
+		wantDest Destination
+		wantCode string
+	}{
+		{"api", []byte(`00040<XML><ProcCode>CSNQ</ProcCode></XML>`), API, "CSNQ"},
+		{"forward", []byte(`00040<XML><ProcCode>CRNQ</ProcCode></XML>`), Forward, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, code := table.Route(tt.msg)
+			if dest != tt.wantDest || code != tt.wantCode {
+				t.Errorf("Route() = %v, %q, want %v, %q", dest, code, tt.wantDest, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestTableRouteCodes(t *testing.T) {
+	table := Table{APIRoutes: []string{"0800", "310000"}}
+
+	tests := []struct {
+		name     string
+		codes    []string
+		wantDest Destination
+		wantCode string
+	}{
+		{"MTI", []string{"0800", "990000"}, API, "0800"},
+		{"processing code", []string{"0200", "310000"}, API, "310000"},
+		{"no match", []string{"0200", "000000"}, Forward, ""},
+		{"partial code", []string{"0200", "3100"}, Forward, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, code := table.RouteCodes(tt.codes...)
+			if dest != tt.wantDest || code != tt.wantCode {
+				t.Errorf("RouteCodes() = %v, %q, want %v, %q", dest, code, tt.wantDest, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	if got := MessageID([]byte(`00030<XML><STAN>123</STAN></XML>`)); got != "123" {
+		t.Errorf("MessageID() = %q, want %q", got, "123")
+	}
+	if got := MessageID([]byte(`hello`)); got != "4f9f2cab" {
+		t.Errorf("MessageID() = %q, want hash fallback", got)
+	}
+}
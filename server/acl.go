@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/metrics"
+)
+
+// ACL metrics
+var aclRejected = metrics.NewCounter("acl_rejected_connections")
+
+// ACL is a CIDR based allow/deny list for client addresses.
+type ACL struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewACL parses the allow and deny lists. Bare IP addresses are accepted as single-host networks.
+func NewACL(cfg config.ACLConfig) (*ACL, error) {
+	allow, err := parseNets(cfg.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow list: %w", err)
+	}
+	deny, err := parseNets(cfg.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny list: %w", err)
+	}
+	return &ACL{allow: allow, deny: deny}, nil
+}
+
+// Permit reports whether a client address may connect.
+// Deny entries take precedence; an empty allow list allows everyone not denied.
+func (a *ACL) Permit(ip net.IP) bool {
+	if ip == nil {
+		return len(a.allow) == 0 && len(a.deny) == 0
+	}
+	for _, n := range a.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, n := range a.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNets parses a list of CIDR networks or IP addresses.
+func parseNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// permitConn checks a connection's remote address against the active ACL.
+func (s *Server) permitConn(conn net.Conn) bool {
+	acl := s.acl.Load()
+	if acl == nil || conn.RemoteAddr().Network() == "unix" {
+		return true
+	}
+	if acl.Permit(net.ParseIP(clientIP(conn.RemoteAddr()))) {
+		return true
+	}
+	aclRejected.Add(1)
+	return false
+}
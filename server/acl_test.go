@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/andrei-cloud/netfwd/config"
+)
+
+func TestACLPermit(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.ACLConfig
+		ip   string
+		want bool
+	}{
+		{"empty lists", config.ACLConfig{}, "192.0.2.1", true},
+		{"allowed network", config.ACLConfig{Allow: []string{"10.0.0.0/8"}}, "10.1.2.3", true},
+		{"not in allow list", config.ACLConfig{Allow: []string{"10.0.0.0/8"}}, "192.0.2.1", false},
+		{"denied host", config.ACLConfig{Deny: []string{"192.0.2.1"}}, "192.0.2.1", false},
+		{"deny wins over allow", config.ACLConfig{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.1.0.0/16"}}, "10.1.2.3", false},
+		{"ipv6", config.ACLConfig{Allow: []string{"2001:db8::/32"}}, "2001:db8::1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := NewACL(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewACL() error = %v", err)
+			}
+			if got := acl.Permit(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("Permit(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewACLInvalid(t *testing.T) {
+	if _, err := NewACL(config.ACLConfig{Allow: []string{"not-an-ip"}}); err == nil {
+		t.Errorf("NewACL() expected error for invalid entry")
+	}
+}
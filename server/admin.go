@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/andrei-cloud/netfwd/queue"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// AdminHandler serves the administration API:
+//
+//	GET  /sessions                      open client sessions
+//	GET  /sessions/{id}                 one client session
+//	POST /deadletters/{id}/resubmit     resubmit a dead-lettered request
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Sessions())
+	})
+	mux.HandleFunc("GET /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid session id", http.StatusBadRequest)
+			return
+		}
+		info, ok := s.Session(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	})
+	mux.HandleFunc("POST /deadletters/{id}/resubmit", func(w http.ResponseWriter, r *http.Request) {
+		res, err := s.Resubmit(r.Context(), r.PathValue("id"))
+		switch {
+		case errors.Is(err, queue.ErrNotFound):
+			http.NotFound(w, r)
+		case err != nil:
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		default:
+			// Responses may carry card and account numbers
+			writeJSON(w, http.StatusOK, map[string]string{"response": transform.Mask(res)})
+		}
+	})
+	return mux
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		slog.Error("Error writing admin response", "error", err)
+	}
+}
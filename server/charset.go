@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/netfwd/charset"
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+// decodeFrame converts a framed message to UTF-8, using the encoding of its XML
+// declaration or def, and reframes it from one framing to another. It returns
+// the character set the message was in, in which the reply is encoded.
+func decodeFrame(from, to framing.Framer, msg []byte, def *charset.Charset) ([]byte, *charset.Charset, error) {
+	body := from.Body(msg)
+	if def == charset.UTF8 && charset.Declared(body) == "" {
+		return *reframe(&msg, from, to), def, nil
+	}
+	utf, c, err := charset.ToUTF8(body, def)
+	if err != nil {
+		return nil, nil, err
+	}
+	return *to.Frame(utf), c, nil
+}
+
+// encodeFrame converts a framed UTF-8 message to c, reframing it from one
+// framing to another.
+func encodeFrame(from, to framing.Framer, msg *[]byte, c *charset.Charset) *[]byte {
+	body := from.Body(*msg)
+	if c == charset.UTF8 && charset.Declared(body) == "" {
+		return reframe(msg, from, to)
+	}
+	return to.Frame(charset.FromUTF8(body, c))
+}
+
+// reframe moves a framed message from one framing to another.
+func reframe(msg *[]byte, from, to framing.Framer) *[]byte {
+	if from == to {
+		return msg
+	}
+	return to.Frame(from.Body(*msg))
+}
+
+// forward sends a message to the forward upstream with send, converting it to the
+// upstream framing and character set and the response back to the client framing
+// and UTF-8. ISO 8583 upstreams exchange binary messages, which are only reframed.
+func (p *Profile) forward(msg *[]byte, send func(*[]byte) (*[]byte, error)) (*[]byte, error) {
+	if p.ISO != nil {
+		res, err := send(reframe(msg, p.Framer, p.ForwardFramer))
+		if err != nil || res == nil {
+			return res, err
+		}
+		return reframe(res, p.ForwardFramer, p.Framer), nil
+	}
+	res, err := send(encodeFrame(p.Framer, p.ForwardFramer, msg, p.ForwardCharset))
+	if err != nil || res == nil {
+		return res, err
+	}
+	utf, _, err := decodeFrame(p.ForwardFramer, p.Framer, *res, p.ForwardCharset)
+	if err != nil {
+		return nil, fmt.Errorf("forward response: %w", err)
+	}
+	return &utf, nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+func TestServerCharset(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"RequestInfo":{"requestId":"1"},"CustomerDetails":[{"FirstName":"محمد","LastName":"José"}]}`))
+	}))
+	defer api.Close()
+
+	// The forward host answers with the text it received, which must be Windows-1256
+	host, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	go func() {
+		c, err := host.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			req, err := framing.Read(c)
+			if err != nil {
+				return
+			}
+			ok := bytes.Contains(req, []byte("<Name>\xe3\xcd\xe3\xcf</Name>"))
+			res := []byte("<XML><Name>\xda\xe1\xc7\xc1</Name><ActCode>0</ActCode></XML>")
+			if !ok {
+				res = []byte("<XML><ActCode>96</ActCode></XML>")
+			}
+			c.Write(*framing.Default.Frame(res))
+		}
+	}()
+
+	cfg := config.Default()
+	cfg.Forward = host.Addr().String()
+	cfg.API = config.APIConfig{URL: api.URL, Username: "u", Password: "p"}
+	cfg.Listeners = []config.ListenerConfig{{
+		Address: "127.0.0.1:0", Charset: "windows-1256", ForwardCharset: "windows-1256",
+	}}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"api", `<XML><ProcCode>CSNQ</ProcCode><STAN>1</STAN></XML>`,
+			[]string{"<Name>\xe3\xcd\xe3\xcf Jos\xe9</Name>"}},
+		{"forward", "<XML><ProcCode>CRNQ</ProcCode><Name>\xe3\xcd\xe3\xcf</Name></XML>",
+			[]string{"<Name>\xda\xe1\xc7\xc1</Name>", "<ActCode>0</ActCode>"}},
+		{"declared", `<?xml version="1.0" encoding="ISO-8859-1"?><XML><ProcCode>CSNQ</ProcCode><STAN>2</STAN></XML>`,
+			[]string{"<Name>???? Jos\xe9</Name>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conn.Write(*framing.Default.Frame([]byte(tt.body))); err != nil {
+				t.Fatal(err)
+			}
+			res, err := framing.Read(conn)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !bytes.Contains(res, []byte(want)) {
+					t.Errorf("response = %q, want %q", res, want)
+				}
+			}
+		})
+	}
+}
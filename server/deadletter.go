@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/queue"
+	"github.com/andrei-cloud/netfwd/routing"
+	"github.com/andrei-cloud/netfwd/transform"
+	"github.com/andrei-cloud/netfwd/upstream"
+)
+
+// deadLettered counts the failed requests written to the dead-letter store
+var deadLettered = metrics.NewCounter("dead_lettered_requests")
+
+// DeadLetter records the requests that fail in the API or the forward upstream.
+type DeadLetter struct {
+	cfg   config.DeadLetterConfig
+	store *queue.Failures
+}
+
+// NewDeadLetter opens the dead-letter directory.
+func NewDeadLetter(cfg config.DeadLetterConfig) (*DeadLetter, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("dead letters require a directory")
+	}
+	store, err := queue.OpenFailures(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetter{cfg: cfg, store: store}, nil
+}
+
+// Middleware writes requests whose processing failed to the dead-letter store.
+// Messages rejected on purpose, which end with a bare ErrCloseConnection, are
+// not failures, and a resubmitted request that fails again keeps its entry.
+func (d *DeadLetter) Middleware(next middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		if ctx.Value(resubmittingKey{}) != nil {
+			return next(ctx, m)
+		}
+		received := time.Now()
+		// Inner middleware may replace m.Body, e.g. with its ISO 8583 translation
+		body := m.Framer.Body(m.Body)
+
+		response, err := next(ctx, m)
+		if err == nil || err == middleware.ErrCloseConnection {
+			return response, err
+		}
+
+		e := &queue.Failure{
+			Listener: m.Listener,
+			Route:    m.Dest.String(),
+			ProcCode: m.ProcCode,
+			STAN:     routing.ExtractTag(body, "STAN"),
+			Error:    err.Error(),
+			Received: received,
+			Failed:   time.Now(),
+			Payload:  transform.Mask(body),
+		}
+		if m.RemoteAddr != nil {
+			e.RemoteAddr = m.RemoteAddr.String()
+		}
+		if d.cfg.KeepRaw {
+			e.Body = append([]byte(nil), body...)
+		}
+		if perr := d.store.Put(e); perr != nil {
+			slog.Error("Failed to write dead letter", "listener", m.Listener, "error", perr)
+			return response, err
+		}
+		deadLettered.Add(1)
+		slog.Warn("Failed request dead-lettered", "listener", m.Listener, "route", e.Route,
+			"procCode", e.ProcCode, "stan", e.STAN, "id", e.ID)
+		return response, err
+	}
+}
+
+// resubmitTimeout bounds the processing of a resubmitted request
+const resubmitTimeout = 30 * time.Second
+
+// resubmittingKey marks the context of a resubmitted request
+type resubmittingKey struct{}
+
+// Resubmit sends a dead-lettered request through the middleware chain of its
+// listener and on to the API or the forward host, as if its client had sent it
+// again. The client connection checks, such as the access lists and the PROXY
+// protocol, passed when the request first arrived. The dead letter is removed
+// once the request is answered, and the response body is returned.
+func (s *Server) Resubmit(ctx context.Context, id string) ([]byte, error) {
+	if s.dl == nil {
+		return nil, errors.New("dead letters are not configured")
+	}
+	e, err := s.dl.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Body == nil {
+		return nil, errors.New("only the masked payload was kept; resubmission requires keepRaw")
+	}
+	p := s.profile(e.Listener)
+	if p == nil {
+		return nil, fmt.Errorf("listener %q is not configured", e.Listener)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, resubmittingKey{}, true), resubmitTimeout)
+	defer cancel()
+
+	framed := p.Framer.Frame(e.Body)
+	dest := p.route(*framed)
+	m := &middleware.Message{
+		Body:       *framed,
+		ProcCode:   routing.ExtractTag(e.Body, "ProcCode"),
+		Dest:       dest,
+		Listener:   p.Name,
+		RemoteAddr: gatewayAddr(e.RemoteAddr),
+		Framer:     p.Framer,
+	}
+	dispatch := func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		return s.dispatchOnce(ctx, p, m)
+	}
+	response, err := middleware.Chain(dispatch, s.chain...)(ctx, m)
+	switch {
+	case err == middleware.ErrCloseConnection:
+		return nil, errors.New("request rejected")
+	case err != nil:
+		return nil, err
+	case response == nil:
+		return nil, errors.New("no response")
+	}
+
+	if err := s.dl.store.Remove(id); err != nil {
+		return nil, err
+	}
+	slog.Info("Dead letter resubmitted", "listener", p.Name, "id", id, "stan", e.STAN)
+	return p.Framer.Body(*response), nil
+}
+
+// dispatchOnce sends a message to the API, or to the forward host of p on a
+// new connection.
+func (s *Server) dispatchOnce(ctx context.Context, p *Profile, m *middleware.Message) (*[]byte, error) {
+	if m.Dest == routing.API {
+		return s.api.Handle(ctx, m.Framer, &m.Body)
+	}
+
+	conn, _, err := p.dialForward(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	return p.forward(&m.Body, func(msg *[]byte) (*[]byte, error) {
+		return upstream.Forward(conn, p.ForwardFramer, msg)
+	})
+}
+
+// deadLetterMiddleware records failed requests when a dead-letter store is configured.
+func (s *Server) deadLetterMiddleware(next middleware.Handler) middleware.Handler {
+	if s.dl == nil {
+		return next
+	}
+	return s.dl.Middleware(next)
+}
+
+// workerError joins the error a worker reported to ErrCloseConnection, so the
+// failure of a message that got no response keeps its cause.
+func workerError(cause *error) error {
+	if cause == nil {
+		return middleware.ErrCloseConnection
+	}
+	return fmt.Errorf("%w: %w", middleware.ErrCloseConnection, *cause)
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/queue"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+func TestDeadLetter(t *testing.T) {
+	const request = "<XML><ProcCode>PURC</ProcCode><STAN>123456</STAN><PAN>4111111111111111</PAN></XML>"
+
+	tests := []struct {
+		name    string
+		keepRaw bool
+	}{
+		{"masked by default", false},
+		{"keeps raw body", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The forward host reads the request and drops the connection unanswered
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { l.Close() })
+			go func() {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				framing.Read(c)
+				c.Close()
+			}()
+
+			cfg := config.Default()
+			cfg.Forward = l.Addr().String()
+			cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+			cfg.Listeners = []config.ListenerConfig{{Name: "pos", Address: "127.0.0.1:0"}}
+			cfg.DeadLetter = &config.DeadLetterConfig{Dir: t.TempDir(), KeepRaw: tt.keepRaw}
+
+			srv, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := srv.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			t.Cleanup(srv.Stop)
+
+			conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write(*framing.Default.Frame([]byte(request))); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := framing.Read(conn); err == nil {
+				t.Fatal("Read() succeeded, want the connection closed")
+			}
+
+			waitFor(t, "the dead letter", func() bool {
+				entries, _ := srv.dl.store.List()
+				return len(entries) == 1
+			})
+			entries, _ := srv.dl.store.List()
+			e := entries[0]
+			if e.Listener != "pos" || e.Route != "forward" || e.ProcCode != "PURC" || e.STAN != "123456" {
+				t.Errorf("Failure = %+v, want the pos PURC request routed to forward", e)
+			}
+			if !strings.Contains(e.Error, "EOF") {
+				t.Errorf("Failure.Error = %q, want the forward host's EOF", e.Error)
+			}
+			if strings.ContainsAny(e.Payload, "0123456789") {
+				t.Errorf("Failure.Payload = %q, want digits masked", e.Payload)
+			}
+			if got, want := string(e.Body), request; !tt.keepRaw && got != "" || tt.keepRaw && got != want {
+				t.Errorf("Failure.Body = %q, keepRaw %v", got, tt.keepRaw)
+			}
+		})
+	}
+}
+
+func TestDeadLetterResubmit(t *testing.T) {
+	forward, received := startHost(t, "127.0.0.1:0", true)
+
+	cfg := config.Default()
+	cfg.Forward = forward
+	cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+	cfg.Listeners = []config.ListenerConfig{{Name: "pos", Address: "127.0.0.1:0"}}
+	cfg.DeadLetter = &config.DeadLetterConfig{Dir: t.TempDir(), KeepRaw: true}
+	// Neither of these admits a local client; resubmission does not go through a client connection
+	cfg.ProxyProtocol = config.ProxyProtocolConfig{Enabled: true, Trusted: []string{"127.0.0.0/8"}}
+	cfg.ACL = config.ACLConfig{Deny: []string{"127.0.0.0/8"}}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(srv.Stop)
+
+	const request = "<XML><ProcCode>PURC</ProcCode><STAN>123456</STAN></XML>"
+	e := &queue.Failure{Listener: "pos", RemoteAddr: "10.0.0.1:4000", Route: "forward", ProcCode: "PURC",
+		STAN: "123456", Error: "EOF", Payload: transform.Mask([]byte(request)), Body: []byte(request)}
+	masked := &queue.Failure{Listener: "pos", Route: "forward", Payload: e.Payload}
+	for _, f := range []*queue.Failure{e, masked} {
+		if err := srv.dl.store.Put(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin := httptest.NewServer(srv.AdminHandler())
+	defer admin.Close()
+	post := func(id string) (int, map[string]string) {
+		res, err := http.Post(admin.URL+"/deadletters/"+id+"/resubmit", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var out map[string]string
+		json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+
+	status, out := post(e.ID)
+	if status != http.StatusOK || out["response"] != "<XML><Reply/></XML>" {
+		t.Fatalf("resubmit = %d %v, want the forward host's response", status, out)
+	}
+	if got := <-received; got != request {
+		t.Errorf("forward host received %s, want %s", got, request)
+	}
+	if _, err := srv.dl.store.Get(e.ID); !errors.Is(err, queue.ErrNotFound) {
+		t.Errorf("Get() after resubmit error = %v, want the dead letter removed", err)
+	}
+
+	if status, _ := post(e.ID); status != http.StatusNotFound {
+		t.Errorf("resubmit of a removed dead letter = %d, want %d", status, http.StatusNotFound)
+	}
+	if status, out := post(masked.ID); status != http.StatusBadGateway || !strings.Contains(out["error"], "masked") {
+		t.Errorf("resubmit of a masked dead letter = %d %v, want an error", status, out)
+	}
+}
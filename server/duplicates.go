@@ -0,0 +1,180 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/routing"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// Duplicate detection metrics
+var (
+	duplicatesReplayed = metrics.NewCounter("duplicates_replayed")
+	duplicatesRejected = metrics.NewCounter("duplicates_rejected")
+)
+
+// Duplicates remembers the requests of a time window so that retransmissions
+// are answered without reaching the API or the forward host again.
+type Duplicates struct {
+	mu      sync.Mutex
+	cfg     config.DuplicateConfig
+	seen    map[string]*list.Element
+	arrival *list.List // seen requests, oldest first
+}
+
+// seenRequest is a request within the window. done is closed once its
+// response, nil when processing failed, is known.
+type seenRequest struct {
+	key      string
+	expires  time.Time
+	done     chan struct{}
+	response []byte
+}
+
+// NewDuplicates applies the defaults of the duplicate detection.
+func NewDuplicates(cfg config.DuplicateConfig) (*Duplicates, error) {
+	switch cfg.Action {
+	case "":
+		cfg.Action = config.DuplicateReplay
+	case config.DuplicateReplay, config.DuplicateReject:
+	default:
+		return nil, fmt.Errorf("unknown duplicate action %q", cfg.Action)
+	}
+	if cfg.Window.Duration <= 0 {
+		cfg.Window.Duration = 60 * time.Second
+	}
+	if len(cfg.KeyFields) == 0 {
+		cfg.KeyFields = []string{"STAN", "LocalTxnDtTime", "DeliveryChannelCtrlID"}
+	}
+	if cfg.ActCode == "" {
+		cfg.ActCode = "94"
+	}
+	if cfg.Description == "" {
+		cfg.Description = "Duplicate transmission"
+	}
+	return &Duplicates{cfg: cfg, seen: make(map[string]*list.Element), arrival: list.New()}, nil
+}
+
+// Middleware answers retransmitted requests with the response of the original,
+// waiting for it while the original is still processed, or with the duplicate
+// action code. A retransmission of a request that failed is processed again.
+func (d *Duplicates) Middleware(next middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		body := m.Framer.Body(m.Body)
+		key, ok := d.key(m.Listener, body)
+		if !ok {
+			return next(ctx, m)
+		}
+
+		r, dup := d.begin(key)
+		if !dup {
+			response, err := next(ctx, m)
+			d.finish(r, response, err)
+			return response, err
+		}
+
+		stan := routing.ExtractTag(body, "STAN")
+		if d.cfg.Action == config.DuplicateReject {
+			duplicatesRejected.Add(1)
+			slog.Warn("Duplicate request rejected", "listener", m.Listener, "procCode", m.ProcCode, "stan", stan)
+			return m.Framer.Frame(transform.Decline(body, d.cfg.ActCode, d.cfg.Description)), nil
+		}
+
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return nil, middleware.ErrCloseConnection
+		}
+		if r.response == nil {
+			slog.Info("Original request failed, processing duplicate", "listener", m.Listener, "stan", stan)
+			return next(ctx, m)
+		}
+		duplicatesReplayed.Add(1)
+		slog.Warn("Duplicate request answered with the original response",
+			"listener", m.Listener, "procCode", m.ProcCode, "stan", stan)
+		response := slices.Clone(r.response)
+		return &response, nil
+	}
+}
+
+// key builds the key of a request from the listener and the configured fields.
+// Requests carrying none of the fields are not checked.
+func (d *Duplicates) key(listener string, body []byte) (string, bool) {
+	var b strings.Builder
+	b.WriteString(listener)
+	found := false
+	for _, field := range d.cfg.KeyFields {
+		v := routing.ExtractTag(body, field)
+		found = found || v != ""
+		b.WriteByte('|')
+		b.WriteString(v)
+	}
+	return b.String(), found
+}
+
+// begin records a request, returning the earlier request with the same key and
+// true when it is a duplicate.
+func (d *Duplicates) begin(key string) (*seenRequest, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.expire(now)
+	if el, ok := d.seen[key]; ok {
+		return el.Value.(*seenRequest), true
+	}
+
+	r := &seenRequest{key: key, expires: now.Add(d.cfg.Window.Duration), done: make(chan struct{})}
+	d.seen[key] = d.arrival.PushBack(r)
+	for d.cfg.MaxEntries > 0 && d.arrival.Len() > d.cfg.MaxEntries {
+		d.remove(d.arrival.Front())
+	}
+	return r, false
+}
+
+// finish stores the response of an original request. A failed request is
+// forgotten so that its retransmission is processed.
+func (d *Duplicates) finish(r *seenRequest, response *[]byte, err error) {
+	if err == nil && response != nil {
+		r.response = slices.Clone(*response)
+	} else {
+		d.mu.Lock()
+		if el, ok := d.seen[r.key]; ok && el.Value == r {
+			d.remove(el)
+		}
+		d.mu.Unlock()
+	}
+	close(r.done)
+}
+
+// expire removes the requests whose window has passed. Requests share the
+// window, so they expire in arrival order.
+func (d *Duplicates) expire(now time.Time) {
+	for el := d.arrival.Front(); el != nil && now.After(el.Value.(*seenRequest).expires); el = d.arrival.Front() {
+		d.remove(el)
+	}
+}
+
+// remove forgets a request.
+func (d *Duplicates) remove(el *list.Element) {
+	d.arrival.Remove(el)
+	delete(d.seen, el.Value.(*seenRequest).key)
+}
+
+// duplicatesMiddleware detects retransmitted requests when configured.
+func (s *Server) duplicatesMiddleware(next middleware.Handler) middleware.Handler {
+	if s.dups == nil {
+		return next
+	}
+	return s.dups.Middleware(next)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/middleware"
+)
+
+// channelRequest builds a channel request with the given STAN and local
+// transaction time.
+func channelRequest(stan, dateTime string) string {
+	return `<XML><MessageType>0</MessageType><ProcCode>PURC</ProcCode>` +
+		`<REFNUM>0220000245250</REFNUM><STAN>` + stan + `</STAN>` +
+		`<LocalTxnDtTime>` + dateTime + `</LocalTxnDtTime><DeliveryChannelCtrlID>ATM</DeliveryChannelCtrlID>` +
+		`<PName>ACCOUNTNUMBER</PName><PValue>157336</PValue></XML>`
+}
+
+func TestDuplicatesMiddleware(t *testing.T) {
+	const noKeys = `<XML><ProcCode>PURC</ProcCode></XML>`
+	var (
+		first     = channelRequest("000245250", "2203221157")
+		otherSTAN = channelRequest("000245251", "2203221157")
+		otherTime = channelRequest("000245250", "2203221158")
+	)
+
+	tests := []struct {
+		name     string
+		cfg      config.DuplicateConfig
+		fail     bool // the first request fails
+		wait     time.Duration
+		first    string
+		second   string
+		listener string
+		want     string // response to the second request
+		calls    int
+	}{
+		{"replayed", config.DuplicateConfig{}, false, 0, first, first, "atm", "reply 1", 1},
+		{"rejected", config.DuplicateConfig{Action: config.DuplicateReject}, false, 0, first, first, "atm",
+			"<ActCode>94</ActCode><ActDescription>Duplicate transmission</ActDescription>", 1},
+		{"other STAN", config.DuplicateConfig{}, false, 0, first, otherSTAN, "atm", "reply 2", 2},
+		{"same STAN at another time", config.DuplicateConfig{}, false, 0, first, otherTime, "atm", "reply 2", 2},
+		{"other listener", config.DuplicateConfig{}, false, 0, first, first, "pos", "reply 2", 2},
+		{"without key fields", config.DuplicateConfig{}, false, 0, noKeys, noKeys, "atm", "reply 2", 2},
+		{"original failed", config.DuplicateConfig{}, true, 0, first, first, "atm", "reply 2", 2},
+		{"window passed", config.DuplicateConfig{Window: config.Duration{Duration: 20 * time.Millisecond}},
+			false, 40 * time.Millisecond, first, first, "atm", "reply 2", 2},
+		{"custom key", config.DuplicateConfig{KeyFields: []string{"LocalTxnDtTime"}}, false, 0, first, otherSTAN, "atm", "reply 1", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDuplicates(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewDuplicates() error = %v", err)
+			}
+
+			calls := 0
+			h := d.Middleware(func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+				calls++
+				if tt.fail && calls == 1 {
+					return nil, errors.New("host unreachable")
+				}
+				res := *framing.Default.Frame(fmt.Appendf(nil, "reply %d", calls))
+				return &res, nil
+			})
+			send := func(listener, body string) (*[]byte, error) {
+				m := &middleware.Message{Body: *framing.Default.Frame([]byte(body)), Listener: listener, Framer: framing.Default}
+				return h(context.Background(), m)
+			}
+
+			send("atm", tt.first)
+			time.Sleep(tt.wait)
+			res, err := send(tt.listener, tt.second)
+			if err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+			if got := string(framing.Default.Body(*res)); !strings.Contains(got, tt.want) {
+				t.Errorf("response = %s, want %s", got, tt.want)
+			}
+			if calls != tt.calls {
+				t.Errorf("requests processed = %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDuplicatesWaitForOriginal(t *testing.T) {
+	d, err := NewDuplicates(config.DuplicateConfig{})
+	if err != nil {
+		t.Fatalf("NewDuplicates() error = %v", err)
+	}
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	h := d.Middleware(func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		res := *framing.Default.Frame([]byte("<XML><ActCode>0</ActCode></XML>"))
+		return &res, nil
+	})
+	send := func() string {
+		m := &middleware.Message{
+			Body:     *framing.Default.Frame([]byte(channelRequest("000245250", "2203221157"))),
+			Listener: "atm",
+			Framer:   framing.Default,
+		}
+		res, err := h(context.Background(), m)
+		if err != nil {
+			return err.Error()
+		}
+		return string(*res)
+	}
+
+	// A retransmission arriving on another connection while the original is
+	// still processed gets the original's response
+	results := make(chan string, 2)
+	go func() { results <- send() }()
+	waitFor(t, "the original request", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls == 1
+	})
+	go func() { results <- send() }()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for range 2 {
+		if got := <-results; !strings.Contains(got, "<ActCode>0</ActCode>") {
+			t.Errorf("response = %s, want the original response", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("requests processed = %d, want 1", calls)
+	}
+}
+
+func TestNewDuplicatesErrors(t *testing.T) {
+	if _, err := NewDuplicates(config.DuplicateConfig{Action: "drop"}); err == nil {
+		t.Error("NewDuplicates() with an unknown action succeeded")
+	}
+}
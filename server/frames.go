@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// Frame recovery metrics
+var (
+	oversizedFrames = metrics.NewCounter("oversized_frames")
+	resyncedFrames  = metrics.NewCounter("resynced_frames")
+)
+
+// recoverFrame applies the recovery configured for the listener after a failed
+// read, reporting whether the connection can go on. Oversized messages follow
+// the oversize policy, skipped ones being answered with a format error on out,
+// and invalid length prefixes are resynchronized when enabled.
+func (s *Server) recoverFrame(r *framing.Reader, p *Profile, err error, addr net.Addr, out chan<- *[]byte) bool {
+	var he *framing.HeaderError
+	if errors.As(err, &he) {
+		if !p.Resync {
+			return false
+		}
+		return resync(r, p, addr, "Invalid length prefix")
+	}
+
+	var se *framing.SizeError
+	if !errors.As(err, &se) {
+		return false
+	}
+	oversizedFrames.Add(1)
+
+	switch p.Oversize {
+	case config.OversizeSkip:
+		head, err := r.Skip(se.Length)
+		if err != nil {
+			slog.Error("Error skipping oversized message", "remoteAddr", addr.String(), "error", err)
+			return false
+		}
+		slog.Warn("Oversized message skipped", "listener", p.Name, "remoteAddr", addr.String(),
+			"length", se.Length, "maxSize", se.Max)
+		decline := transform.Decline(head, p.OversizeCode, p.OversizeDescription)
+		out <- encodeFrame(p.Framer, p.Framer, p.Framer.Frame(decline), p.Charset)
+		return true
+
+	case config.OversizeResync:
+		return resync(r, p, addr, "Oversized length prefix")
+	}
+
+	slog.Warn("Oversized message, closing connection", "listener", p.Name, "remoteAddr", addr.String(),
+		"length", se.Length, "maxSize", se.Max)
+	return false
+}
+
+// resync scans for the next message after a bad length prefix, logging the
+// bytes dropped with digits masked.
+func resync(r *framing.Reader, p *Profile, addr net.Addr, reason string) bool {
+	skipped, discarded, err := r.Resync()
+	if err != nil {
+		slog.Error(reason+", no message found after it", "listener", p.Name, "remoteAddr", addr.String(),
+			"skipped", skipped, "discarded", transform.Mask(discarded), "error", err)
+		return false
+	}
+	resyncedFrames.Add(1)
+	slog.Warn(reason+", resynchronized", "listener", p.Name, "remoteAddr", addr.String(),
+		"skipped", skipped, "discarded", transform.Mask(discarded))
+	return true
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+func TestServerOversize(t *testing.T) {
+	large := `<XML><ProcCode>CRNQ</ProcCode><STAN>7</STAN><Data>0123456789</Data></XML>`
+	small := `<XML><STAN>8</STAN></XML>`
+
+	tests := []struct {
+		name   string
+		policy string
+		want   []string // responses in order, the connection closes after them
+	}{
+		{"close", config.OversizeClose, nil},
+		{"skip", config.OversizeSkip, []string{"<STAN>7</STAN><LocalTxnDtTime></LocalTxnDtTime>", small}},
+		{"resync", config.OversizeResync, []string{small}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Forward = startEcho(t)
+			cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+			cfg.Listeners = []config.ListenerConfig{{
+				Address: "127.0.0.1:0",
+				Framing: config.FramingConfig{MaxSize: 32, Oversize: tt.policy},
+			}}
+
+			srv, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := srv.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer srv.Stop()
+
+			conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			conn.Write(*framing.Default.Frame([]byte(large)))
+			conn.Write(*framing.Default.Frame([]byte(small)))
+			conn.(*net.TCPConn).CloseWrite()
+
+			for _, want := range tt.want {
+				res, err := framing.Read(conn)
+				if err != nil {
+					t.Fatalf("Read() error = %v, want response %s", err, want)
+				}
+				if !bytes.Contains(res, []byte(want)) {
+					t.Errorf("response = %s, want %s", res, want)
+				}
+			}
+			// Unread client data may reset rather than close the connection
+			if rest, _ := io.ReadAll(conn); len(rest) > 0 {
+				t.Errorf("after responses read %q, want connection closed", rest)
+			}
+		})
+	}
+}
+
+func TestServerResync(t *testing.T) {
+	msg := *framing.Default.Frame([]byte(`<XML><STAN>9</STAN></XML>`))
+
+	tests := []struct {
+		name   string
+		resync bool
+		limit  int
+		want   bool // the message after the garbage is answered
+	}{
+		{"disabled", false, 0, false},
+		{"enabled", true, 0, true},
+		{"garbage over the limit", true, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Forward = startEcho(t)
+			cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+			cfg.Listeners = []config.ListenerConfig{{
+				Address: "127.0.0.1:0",
+				Framing: config.FramingConfig{Resync: tt.resync, ResyncLimit: tt.limit},
+			}}
+
+			srv, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := srv.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer srv.Stop()
+
+			conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			conn.Write(append([]byte("\x02garbage 4111111111111111\x03"), msg...))
+			conn.(*net.TCPConn).CloseWrite()
+
+			res, err := framing.Read(conn)
+			if got := err == nil && bytes.Equal(res, msg); got != tt.want {
+				t.Errorf("response = %q, %v, want answered %v", res, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerFraming(t *testing.T) {
+	tests := []struct {
+		name    string
+		framing config.FramingConfig
+		forward framing.Framer // framing the forward host reads and answers with
+	}{
+		{"ETX client, length-prefixed forward",
+			config.FramingConfig{Mode: framing.Delimited, Delimiter: "\x03", ForwardMode: framing.LengthPrefixed},
+			framing.Default},
+		{"length-prefixed client, XML documents forward",
+			config.FramingConfig{ForwardMode: framing.XMLDocument},
+			framing.Framer{Mode: framing.XMLDocument}},
+		{"newline client, ETX forward",
+			config.FramingConfig{Mode: framing.Delimited, Delimiter: "\n", ForwardDelimiter: "\x03"},
+			framing.Framer{Mode: framing.Delimited, Delimiter: "\x03"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The forward host answers each message with its body in a Reply element
+			host, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer host.Close()
+			go func() {
+				c, err := host.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				r := tt.forward.NewReader(c)
+				for {
+					fr, err := r.ReadFrame()
+					if err != nil {
+						return
+					}
+					res := append(append([]byte("<Reply>"), fr.Body...), "</Reply>"...)
+					fr.Release()
+					c.Write(*tt.forward.Frame(res))
+				}
+			}()
+
+			cfg := config.Default()
+			cfg.Forward = host.Addr().String()
+			cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+			cfg.Listeners = []config.ListenerConfig{{Address: "127.0.0.1:0", Framing: tt.framing}}
+
+			srv, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := srv.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer srv.Stop()
+
+			conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			client := srv.profiles[0].Framer
+			r := client.NewReader(conn)
+			for _, stan := range []string{"1", "2"} {
+				body := "<XML><ProcCode>CRNQ</ProcCode><STAN>" + stan + "</STAN></XML>"
+				if _, err := conn.Write(*client.Frame([]byte(body))); err != nil {
+					t.Fatal(err)
+				}
+				fr, err := r.ReadFrame()
+				if err != nil {
+					t.Fatalf("ReadFrame() error = %v", err)
+				}
+				if want := "<Reply>" + body + "</Reply>"; string(fr.Body) != want {
+					t.Errorf("response = %q, want %q", fr.Body, want)
+				}
+				fr.Release()
+			}
+		})
+	}
+}
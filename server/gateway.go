@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/routing"
+	"github.com/andrei-cloud/netfwd/transform"
+	"github.com/andrei-cloud/netfwd/upstream"
+)
+
+// maxGatewayBody limits the size of gateway request bodies
+const maxGatewayBody = 1 << 20
+
+// gatewayRequests counts HTTP requests handled by gateway listeners
+var gatewayRequests = metrics.NewCounter("gateway_requests")
+
+// gateway turns HTTP/JSON requests into XML messages for the forward host or the API.
+type gateway struct {
+	s      *Server
+	p      *Profile
+	pool   *upstream.Pool
+	active atomic.Int32 // forward upstream the pooled connections were dialed to
+}
+
+// serveGateway serves HTTP requests on a gateway listener until ctx is canceled.
+func (s *Server) serveGateway(ctx context.Context, l net.Listener, p *Profile) {
+	if s.limits != nil {
+		l = &limitedListener{Listener: l, ctx: ctx, limits: s.limits}
+	}
+	if s.proxy != nil {
+		l = &proxyListener{Listener: l, proxy: s.proxy}
+	}
+	if p.TLS != nil {
+		l = tls.NewListener(l, p.TLS)
+	}
+
+	dial := func(ctx context.Context) (net.Conn, error) {
+		conn, _, err := p.dialForward(ctx)
+		return conn, err
+	}
+	pool := upstream.NewDialPool(dial, p.ForwardFramer, p.Gateway.PoolSize, p.Gateway.Timeout.Duration)
+	defer pool.Close()
+
+	g := &gateway{s: s, p: p, pool: pool}
+	g.active.Store(p.active.Load())
+	hs := &http.Server{
+		Handler:           g,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	stop := context.AfterFunc(ctx, func() { hs.Close() })
+	defer stop()
+
+	if err := hs.Serve(l); err != nil && ctx.Err() == nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Gateway stopped", "listener", p.Name, "error", err)
+		return
+	}
+	slog.Info("Gateway shutting down", "listener", p.Name)
+}
+
+// ServeHTTP converts a JSON object to an XML message, sends it through the
+// middleware chain and answers with the XML response as a JSON object.
+// The last path segment, if any, is used as ProcCode when the body has none.
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gatewayRequests.Add(1)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGatewayError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	addr := gatewayAddr(r.RemoteAddr)
+	if acl := g.s.acl.Load(); acl != nil && !acl.Permit(net.ParseIP(clientIP(addr))) {
+		aclRejected.Add(1)
+		writeGatewayError(w, http.StatusForbidden, "client not allowed")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGatewayBody))
+	if err != nil {
+		writeGatewayError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	body, err := transform.JSONToXML(data)
+	if err != nil {
+		writeGatewayError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Fill in the ProcCode from the path and generate a STAN when the caller gave none
+	var missing []string
+	if code := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]; code != "" && routing.ExtractTag(body, "ProcCode") == "" {
+		missing = append(missing, "ProcCode", code)
+	}
+	if routing.ExtractTag(body, "STAN") == "" {
+		missing = append(missing, "STAN", g.s.nextSTAN())
+	}
+	body = prependTags(body, missing...)
+
+	framed := g.p.Framer.Frame(body)
+	dest := g.p.route(*framed)
+	m := &middleware.Message{
+		Body:       *framed,
+		ProcCode:   routing.ExtractTag(body, "ProcCode"),
+		Dest:       dest,
+		Listener:   g.p.Name,
+		RemoteAddr: addr,
+		Framer:     g.p.Framer,
+	}
+
+	response, err := middleware.Chain(g.dispatch, g.s.chain...)(r.Context(), m)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeGatewayError(w, http.StatusGatewayTimeout, "upstream timeout")
+		return
+	case errors.Is(err, middleware.ErrCloseConnection):
+		writeGatewayError(w, http.StatusServiceUnavailable, "request rejected")
+		return
+	case err != nil:
+		slog.Error("Gateway request failed", "listener", g.p.Name, "error", err)
+		writeGatewayError(w, http.StatusBadGateway, "upstream error")
+		return
+	case response == nil:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	out, err := transform.XMLToJSON(g.p.Framer.Body(*response))
+	if err != nil {
+		slog.Error("Invalid gateway response", "listener", g.p.Name, "error", err)
+		writeGatewayError(w, http.StatusBadGateway, "invalid upstream response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// dispatch sends the message to the API or through the forward upstream pool.
+// The pooled connections are dropped once the listener failed over to another
+// forward upstream.
+func (g *gateway) dispatch(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+	if m.Dest == routing.API {
+		return g.s.api.Handle(ctx, m.Framer, &m.Body)
+	}
+	if active := g.p.active.Load(); g.active.Swap(active) != active {
+		g.pool.CloseIdle()
+	}
+	return g.p.forward(&m.Body, func(msg *[]byte) (*[]byte, error) {
+		return g.pool.Forward(ctx, msg)
+	})
+}
+
+// writeGatewayError answers with a JSON error object.
+func writeGatewayError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// prependTags inserts tag and value pairs at the start of an XML message.
+func prependTags(msg []byte, pairs ...string) []byte {
+	if len(pairs) == 0 {
+		return msg
+	}
+	root := bytes.IndexByte(msg, '>') + 1
+
+	var out bytes.Buffer
+	out.Write(msg[:root])
+	for i := 0; i+1 < len(pairs); i += 2 {
+		out.WriteString("<" + pairs[i] + ">")
+		xml.EscapeText(&out, []byte(pairs[i+1]))
+		out.WriteString("</" + pairs[i] + ">")
+	}
+	out.Write(msg[root:])
+	return out.Bytes()
+}
+
+// limitedListener holds a slot of the concurrent connections cap for each
+// accepted connection until it is closed.
+type limitedListener struct {
+	net.Listener
+	ctx    context.Context
+	limits *Limits
+}
+
+// Accept implements net.Listener, closing the connections over the cap.
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.limits.AcquireConnection(l.ctx) {
+			return &limitedConn{Conn: conn, release: sync.OnceFunc(l.limits.ReleaseConnection)}, nil
+		}
+		slog.Warn("Connection limit reached, closing connection", "remoteAddr", conn.RemoteAddr().String())
+		closeConn(conn)
+	}
+}
+
+// limitedConn releases its connection slot when closed.
+type limitedConn struct {
+	net.Conn
+	release func()
+}
+
+// Close implements net.Conn.
+func (c *limitedConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
+
+// gatewayAddr is the client address of an HTTP request.
+type gatewayAddr string
+
+// Network implements net.Addr.
+func (a gatewayAddr) Network() string { return "tcp" }
+
+// String implements net.Addr.
+func (a gatewayAddr) String() string { return string(a) }
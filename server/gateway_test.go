@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/limit"
+)
+
+func TestGateway(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"RequestInfo":{"requestId":"1","basenumber":"157336"},"CustomerDetails":[{"BASENO":"157336"}]}`))
+	}))
+	defer api.Close()
+
+	cfg := config.Default()
+	cfg.Forward = startEcho(t)
+	cfg.API = config.APIConfig{URL: api.URL, Username: "u", Password: "p"}
+	cfg.Listeners = []config.ListenerConfig{{
+		Name:    "mobile",
+		Address: "127.0.0.1:0",
+		Gateway: &config.GatewayConfig{},
+	}}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+	base := "http://" + srv.Addrs()[0].String()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{"forward with generated STAN", http.MethodPost, "/", `{"ProcCode":"CRNQ","PValue":"157336"}`,
+			http.StatusOK, `{"STAN":"000001","ProcCode":"CRNQ","PValue":"157336"}`},
+		{"forward with caller STAN", http.MethodPost, "/", `{"ProcCode":"CRNQ","STAN":"42"}`,
+			http.StatusOK, `{"ProcCode":"CRNQ","STAN":"42"}`},
+		{"ProcCode from path routed to the API", http.MethodPost, "/v1/CSNQ", `{"STAN":"7","PName":"ACCOUNTNUMBER","PValue":"157336"}`,
+			http.StatusOK, `"ActCode":"0"`},
+		{"invalid JSON", http.MethodPost, "/", `{"ProcCode":`, http.StatusBadRequest, `"error"`},
+		{"wrong method", http.MethodGet, "/", ``, http.StatusMethodNotAllowed, `"error"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, base+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextSTAN(t *testing.T) {
+	s := &Server{}
+	s.stan.Store(999998)
+
+	for _, want := range []string{"999999", "000001", "000002"} {
+		if got := s.nextSTAN(); got != want {
+			t.Errorf("nextSTAN() = %s, want %s", got, want)
+		}
+	}
+}
+
+// startGateway starts a server with a gateway listener configured by setup.
+func startGateway(t *testing.T, setup func(cfg *config.Config)) string {
+	cfg := config.Default()
+	cfg.Forward = startEcho(t)
+	cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+	cfg.Listeners = []config.ListenerConfig{{
+		Name:    "mobile",
+		Address: "127.0.0.1:0",
+		Gateway: &config.GatewayConfig{},
+	}}
+	setup(cfg)
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	return "http://" + srv.Addrs()[0].String()
+}
+
+// postGateway sends a JSON request to a gateway and returns the response body.
+func postGateway(client *http.Client, url, body string) (string, error) {
+	res, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	out, err := io.ReadAll(res.Body)
+	return string(out), err
+}
+
+func TestGatewayFailover(t *testing.T) {
+	failover := startEcho(t)
+	base := startGateway(t, func(cfg *config.Config) {
+		cfg.Listeners[0].Forward = unusedAddr(t)
+		cfg.Listeners[0].Failover = []string{failover}
+	})
+
+	got, err := postGateway(http.DefaultClient, base, `{"ProcCode":"CRNQ","STAN":"42"}`)
+	if err != nil || !strings.Contains(got, `"STAN":"42"`) {
+		t.Errorf("POST = %s, %v, want the answer of the failover upstream", got, err)
+	}
+}
+
+func TestGatewayLimits(t *testing.T) {
+	t.Run("rate limit", func(t *testing.T) {
+		base := startGateway(t, func(cfg *config.Config) {
+			cfg.Limits.ClientRate = config.RateConfig{Rate: 0.001, Burst: 1, Policy: limit.Decline}
+			cfg.Limits.DeclineCode = "91"
+		})
+
+		for i, want := range []string{`"STAN":"1"`, `"ActCode":"91"`} {
+			got, err := postGateway(http.DefaultClient, base, `{"ProcCode":"CRNQ","STAN":"1"}`)
+			if err != nil || !strings.Contains(got, want) {
+				t.Errorf("POST %d = %s, %v, want %s", i+1, got, err, want)
+			}
+		}
+	})
+
+	t.Run("connection cap", func(t *testing.T) {
+		base := startGateway(t, func(cfg *config.Config) {
+			cfg.Limits.MaxConnections = 1
+			cfg.Limits.ConnectionPolicy = limit.Close
+		})
+
+		// A kept-alive connection holds the only slot
+		first := &http.Client{Transport: &http.Transport{}}
+		defer first.CloseIdleConnections()
+		if _, err := postGateway(first, base, `{"ProcCode":"CRNQ"}`); err != nil {
+			t.Fatalf("POST on the first connection error = %v", err)
+		}
+		second := &http.Client{Transport: &http.Transport{}}
+		if got, err := postGateway(second, base, `{"ProcCode":"CRNQ"}`); err == nil {
+			t.Errorf("POST on a second connection = %s, want the connection closed", got)
+		}
+
+		// The slot is freed with the connection
+		first.CloseIdleConnections()
+		waitFor(t, "the connection slot", func() bool {
+			_, err := postGateway(second, base, `{"ProcCode":"CRNQ"}`)
+			return err == nil
+		})
+	})
+}
+
+func TestGatewayProxyProtocol(t *testing.T) {
+	base := startGateway(t, func(cfg *config.Config) {
+		cfg.ProxyProtocol = config.ProxyProtocolConfig{Enabled: true, Trusted: []string{"127.0.0.0/8"}}
+		cfg.ACL = config.ACLConfig{Deny: []string{"203.0.113.0/24"}}
+	})
+	addr := strings.TrimPrefix(base, "http://")
+
+	tests := []struct {
+		name   string
+		header string
+		want   int // 0 when the connection is closed
+	}{
+		{"allowed client", "PROXY TCP4 198.51.100.1 127.0.0.1 1234 80\r\n", http.StatusOK},
+		{"denied client", "PROXY TCP4 203.0.113.7 127.0.0.1 1234 80\r\n", http.StatusForbidden},
+		{"missing header", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			body := `{"ProcCode":"CRNQ"}`
+			fmt.Fprintf(conn, "%sPOST / HTTP/1.1\r\nHost: netfwd\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
+				tt.header, len(body), body)
+			res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			got := 0
+			if err == nil {
+				got = res.StatusCode
+				res.Body.Close()
+			}
+			if got != tt.want {
+				t.Errorf("status = %d (%v), want %d", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/routing"
+	"github.com/andrei-cloud/netfwd/upstream"
+)
+
+// drainTimeout bounds writing the queued responses of a closing connection
+const drainTimeout = 5 * time.Second
+
+// accepter handles incoming connections on a listener
+func (s *Server) accepter(ctx context.Context, l net.Listener, p *Profile) {
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Accepter shutting down", "listener", p.Name)
+			if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				slog.Error("Error closing listener", "error", err)
+			}
+			return
+		default:
+			conn, err := l.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					slog.Info("Accepter shutting down", "listener", p.Name)
+					return
+				}
+				if isTemporaryError(err) {
+					slog.Warn("Temporary error accepting connection", "error", err)
+					continue
+				}
+				slog.Error("Fatal error accepting connection", "error", err)
+				return
+			}
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.admit(ctx, conn, p)
+			}()
+		}
+	}
+}
+
+// admit resolves the real client address and applies the access list and
+// connection cap before handing the connection to connectionHandler.
+func (s *Server) admit(ctx context.Context, conn net.Conn, p *Profile) {
+	// Track the raw connection so Stop can close it
+	if !s.track(conn) {
+		closeConn(conn)
+		return
+	}
+	defer s.untrack(conn)
+
+	// Take the client address from the PROXY protocol header when enabled
+	if s.proxy != nil {
+		wrapped, err := s.proxy.Wrap(conn)
+		if err != nil {
+			slog.Warn("Invalid PROXY protocol header, closing connection",
+				"peerAddr", conn.RemoteAddr().String(), "error", err)
+			closeConn(conn)
+			return
+		}
+		conn = wrapped
+	}
+
+	// Check the client against the allow and deny lists
+	if !s.permitConn(conn) {
+		slog.Warn("Connection rejected by access list", "remoteAddr", conn.RemoteAddr().String())
+		closeConn(conn)
+		return
+	}
+
+	// Enforce the concurrent connections cap
+	if s.limits != nil {
+		if !s.limits.AcquireConnection(ctx) {
+			slog.Warn("Connection limit reached, closing connection", "remoteAddr", conn.RemoteAddr().String())
+			closeConn(conn)
+			return
+		}
+		defer s.limits.ReleaseConnection()
+	}
+
+	// The PROXY header precedes the TLS handshake
+	if p.TLS != nil {
+		conn = tls.Server(conn, p.TLS)
+	}
+
+	slog.Info("Incoming connection established", "listener", p.Name, "remoteAddr", conn.RemoteAddr().String())
+	s.connectionHandler(ctx, conn, p)
+}
+
+// closeConn closes a connection, logging any error
+func closeConn(conn net.Conn) {
+	if err := conn.Close(); err != nil {
+		slog.Error("Error closing connection", "error", err)
+	}
+}
+
+// isTemporaryError checks if the error is temporary and we should continue
+func isTemporaryError(err error) bool {
+	// As of Go 1.18, netErr.Temporary() is deprecated
+	// Instead, we'll check for specific error types that represent temporary conditions
+	if e, ok := err.(interface{ Timeout() bool }); ok && e.Timeout() {
+		return true
+	}
+
+	// Check other types of errors that are typically temporary
+	switch err.Error() {
+	case "connection reset by peer", "use of closed network connection", "i/o timeout":
+		return true
+	}
+
+	return false
+}
+
+// connectionHandler manages the lifecycle of a client connection
+func (s *Server) connectionHandler(ctx context.Context, conn net.Conn, p *Profile) {
+	// The summary is logged last, once the queued responses were written
+	session, conn := s.openSession(p, conn)
+	defer s.closeSession(session)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	errCh := make(chan error, 1)
+	responseOut := make(chan *[]byte, 1)
+	apiRequest := make(chan *[]byte, 1)
+
+	senderDone := make(chan struct{})
+
+	defer func() {
+		slog.Info("Closing connection", "remoteAddr", conn.RemoteAddr().String())
+		// Let the sender write the responses still queued, e.g. after the client
+		// half-closed the connection, without waiting on a stalled client
+		close(responseOut)
+		conn.SetWriteDeadline(time.Now().Add(drainTimeout))
+		<-senderDone
+		cancel()
+		// errCh stays open: workers may still report the error that ended the session
+		closeChannels(apiRequest)
+		if err := conn.Close(); err != nil {
+			slog.Error("Error closing connection", "error", err)
+		}
+	}()
+
+	// Without a forward host, store and forward still accepts the queued messages.
+	// The link is replaced when the heartbeat fails the session over.
+	var link atomic.Pointer[forwardLink]
+	first, err := openLink(ctx, p, errCh)
+	switch {
+	case err != nil && s.sf == nil:
+		close(senderDone)
+		slog.Error("Unable to establish remote connection", "error", err)
+		return
+	case err != nil:
+		slog.Warn("Unable to establish remote connection, only queueing messages", "error", err)
+	default:
+		link.Store(first)
+	}
+
+	go func() {
+		defer close(senderDone)
+		upstream.SourceSenderWorker(ctx, responseOut, conn, errCh)
+	}()
+
+	// Create API workers based on CPU count for parallel processing
+	numWorkers := runtime.NumCPU()
+	results := make([]<-chan *[]byte, numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		results[i] = upstream.APIWorker(ctx, s.api, apiRequest, p.Framer, errCh)
+	}
+
+	apiResponses := upstream.FanIn(ctx, results...)
+	var (
+		quit  atomic.Bool
+		cause atomic.Pointer[error] // the worker error that ended the session
+	)
+
+	// exchange sends a frame to the forward worker and waits for its response,
+	// one exchange at a time so heartbeats do not take a client's response. A
+	// positive timeout bounds the wait for the response once the frame is sent.
+	// The frame is released by the worker once written, or here when not sent.
+	exchangeSem := make(chan struct{}, 1)
+	var lastForward atomic.Int64
+	exchange := func(ctx context.Context, fr *framing.Frame, timeout time.Duration) (*[]byte, error) {
+		select {
+		case exchangeSem <- struct{}{}:
+		case <-ctx.Done():
+			fr.Release()
+			return nil, ctx.Err()
+		}
+		defer func() { <-exchangeSem }()
+
+		l := link.Load()
+		if l == nil {
+			fr.Release()
+			return nil, nil
+		}
+		lastForward.Store(time.Now().UnixNano())
+		select {
+		case l.requests <- fr:
+		case <-ctx.Done():
+			fr.Release()
+			return nil, ctx.Err()
+		}
+		var expired <-chan time.Time
+		if timeout > 0 {
+			t := time.NewTimer(timeout)
+			defer t.Stop()
+			expired = t.C
+		}
+		select {
+		case res := <-l.responses:
+			return res, nil
+		case <-expired:
+			return nil, errNoAnswer
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if first != nil && p.Heartbeat != nil && p.Heartbeat.Interval.Duration > 0 {
+		idle := func() time.Duration { return time.Since(time.Unix(0, lastForward.Load())) }
+		lastForward.Store(time.Now().UnixNano())
+		// redial moves the session to the active forward upstream between exchanges
+		redial := func() (string, error) {
+			select {
+			case exchangeSem <- struct{}{}:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			defer func() { <-exchangeSem }()
+
+			next, err := openLink(ctx, p, errCh)
+			if err != nil {
+				return "", err
+			}
+			if old := link.Swap(next); old != nil {
+				old.cancel()
+			}
+			return next.addr, nil
+		}
+		// Without a forward host left the session ends, unblocking the read of the next message
+		end := func() {
+			cancel()
+			conn.SetReadDeadline(time.Now())
+		}
+		go s.heartbeat(ctx, p, first.addr, idle, exchange, redial, end)
+	}
+
+	// client is the pooled frame of the message being handled. A message
+	// forwarded unchanged is sent from it, the worker holding it until written.
+	var client *framing.Frame
+
+	// dispatch hands the message to the API or forward workers and waits for the response
+	dispatch := func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		var response *[]byte
+		if m.Dest == routing.API {
+			apiRequest <- &m.Body
+			response = <-apiResponses
+		} else {
+			var err error
+			response, err = p.forward(&m.Body, func(msg *[]byte) (*[]byte, error) {
+				fr := p.ForwardFramer.Wrap(*msg)
+				if client != nil && sameBuffer(*msg, client.Bytes()) {
+					client.Retain()
+					fr = client
+				}
+				// A missing response closes the session with the worker's error
+				res, _ := exchange(ctx, fr, 0)
+				return res, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Workers stopped without a response, e.g. after an error closed the connection
+		if response == nil {
+			return nil, workerError(cause.Load())
+		}
+		return response, nil
+	}
+	handler := middleware.Chain(dispatch, s.chain...)
+
+	// Error handling goroutine
+	go func() {
+		defer func() {
+			cancel()
+			quit.Store(true)
+		}()
+
+		for {
+			select {
+			case err := <-errCh:
+				cause.Store(&err)
+				if err == io.EOF {
+					slog.Info("Connection closed")
+					return
+				}
+				slog.Error("Worker returned error", "error", err)
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Main message processing loop
+	reader := p.Framer.NewReader(conn)
+	for !quit.Load() {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				session.fail()
+			}
+			if s.recoverFrame(reader, p, err, conn.RemoteAddr(), responseOut) {
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				slog.Info("Client connection closed")
+				return
+			}
+			slog.Error("Error reading from client", "error", err)
+			cancel()
+			return
+		}
+
+		// Process messages in UTF-8, answering in the client's character set.
+		// Unconverted messages are forwarded straight from the read buffer.
+		buf, cs, err := decodeFrame(p.Framer, p.Framer, frame.Bytes(), p.Charset)
+		if err != nil {
+			frame.Release()
+			session.fail()
+			slog.Error("Error decoding client message", "error", err)
+			cancel()
+			return
+		}
+
+		// Route message based on content - check for any of the API process codes
+		dest := p.route(buf)
+		m := &middleware.Message{
+			Body:       buf,
+			ProcCode:   routing.ExtractTag(buf, "ProcCode"),
+			Dest:       dest,
+			Listener:   p.Name,
+			RemoteAddr: conn.RemoteAddr(),
+			Framer:     p.Framer,
+		}
+
+		stan := routing.ExtractTag(buf, "STAN")
+		session.begin(dest.String(), stan)
+		client = frame
+		response, err := handler(ctx, m)
+		session.end(stan, err)
+		client = nil
+		frame.Release()
+		if err != nil {
+			if !errors.Is(err, middleware.ErrCloseConnection) {
+				slog.Error("Error processing message", "error", err)
+			}
+			cancel()
+			return
+		}
+		if response == nil {
+			continue
+		}
+
+		// Send response back to client
+		responseOut <- encodeFrame(p.Framer, p.Framer, response, cs)
+	}
+}
+
+// sameBuffer reports whether a and b are the same bytes in memory.
+func sameBuffer(a, b []byte) bool {
+	return len(a) > 0 && len(a) == len(b) && &a[0] == &b[0]
+}
+
+// forwardLink is a session's connection to a forward upstream and the worker
+// exchanging messages on it. Canceling the link closes the connection.
+type forwardLink struct {
+	addr      string // configured address of the upstream
+	requests  chan *framing.Frame
+	responses chan *[]byte
+	cancel    context.CancelFunc
+}
+
+// openLink connects to the active forward upstream of p. Worker errors end
+// the session through errCh until the link is canceled.
+func openLink(ctx context.Context, p *Profile, errCh chan error) (*forwardLink, error) {
+	remote, addr, err := p.dialForward(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Connected to remote host", "forward", addr, "remoteAddr", remote.RemoteAddr().String())
+
+	ctx, cancel := context.WithCancel(ctx)
+	context.AfterFunc(ctx, func() {
+		if err := remote.Close(); err != nil {
+			slog.Error("Error closing remote connection", "error", err)
+		}
+	})
+
+	// The errors of a replaced link, e.g. its closed connection, are dropped
+	workerErr := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case err := <-workerErr:
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case errCh <- err:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	requests := make(chan *framing.Frame, 1)
+	return &forwardLink{
+		addr:      addr,
+		requests:  requests,
+		responses: upstream.ProxyWorker(ctx, requests, remote, p.ForwardFramer, workerErr),
+		cancel:    cancel,
+	}, nil
+}
+
+// closeChannels safely closes multiple channels
+func closeChannels(channels ...chan *[]byte) {
+	for _, ch := range channels {
+		close(ch)
+	}
+}
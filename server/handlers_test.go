@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+func Test_connectionHandler(t *testing.T) {
+	type args struct {
+		ctx  context.Context
+		conn net.Conn
+		p    *Profile
+	}
+	tests := []struct {
+		name string
+		args args
+	}{
+		// TODO: Add test cases.
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{}
+			s.connectionHandler(tt.args.ctx, tt.args.conn, tt.args.p)
+		})
+	}
+}
+
+// startEcho starts a forward host that echoes everything back.
+func startEcho(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"RequestInfo":{"requestId":"1","basenumber":"157336"},"CustomerDetails":[{"BASENO":"157336"}]}`))
+	}))
+	defer api.Close()
+
+	cfg := config.Default()
+	cfg.Listen = "127.0.0.1:0"
+	cfg.Forward = startEcho(t)
+	cfg.API = config.APIConfig{URL: api.URL, Username: "u", Password: "p"}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"api", `<XML><ProcCode>CSNQ</ProcCode><STAN>1</STAN></XML>`, "<ActCode>0</ActCode>"},
+		{"forward", `<XML><ProcCode>CRNQ</ProcCode><STAN>2</STAN></XML>`, "<ProcCode>CRNQ</ProcCode>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conn.Write(*framing.Default.Frame([]byte(tt.body))); err != nil {
+				t.Fatal(err)
+			}
+			res, err := framing.Read(conn)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !bytes.Contains(res, []byte(tt.want)) {
+				t.Errorf("response = %s, want %s", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMissingMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(cfg *config.Config)
+		list    []string
+		wantErr bool
+	}{
+		{"default list", func(cfg *config.Config) {
+			cfg.Duplicates = &config.DuplicateConfig{}
+		}, nil, false},
+		{"duplicates left out", func(cfg *config.Config) {
+			cfg.Duplicates = &config.DuplicateConfig{}
+		}, []string{"logging"}, true},
+		{"rate limits left out", func(cfg *config.Config) {
+			cfg.Limits.ClientRate = config.RateConfig{Rate: 10, Burst: 10}
+		}, []string{"logging", "validation"}, true},
+		{"connection cap only", func(cfg *config.Config) {
+			cfg.Limits.MaxConnections = 10
+		}, []string{"logging"}, false},
+		{"validation left out", func(cfg *config.Config) {
+			cfg.Validation.Rules = map[string][]config.FieldRule{"CSNQ": {{Field: "STAN", Required: true}}}
+		}, []string{"limits"}, true},
+		{"heartbeat left out", func(cfg *config.Config) {
+			cfg.Listeners = []config.ListenerConfig{{Name: "atm", Address: "127.0.0.1:0",
+				Heartbeat: &config.HeartbeatConfig{ProcCodes: []string{"ECHO"}}}}
+		}, []string{"logging"}, true},
+		{"nothing configured", func(cfg *config.Config) {}, []string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+			tt.setup(cfg)
+			if tt.list != nil {
+				cfg.Middleware = tt.list
+			}
+			_, err := New(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	cfg := config.Default()
+	cfg.Listen = "127.0.0.1:0"
+	cfg.Forward = startEcho(t)
+	cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+	cfg.Middleware = []string{"logging", "reject"}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err == nil {
+		srv.Stop()
+		t.Fatal("Start() with unknown middleware succeeded, want error")
+	}
+
+	// Answer every message locally instead of forwarding it
+	srv.Register("reject", func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+			return m.Framer.Frame(transform.Decline(m.Body, "05", "Rejected")), nil
+		}
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(*framing.Default.Frame([]byte(`<XML><ProcCode>CRNQ</ProcCode><STAN>3</STAN></XML>`))); err != nil {
+		t.Fatal(err)
+	}
+	res, err := framing.Read(conn)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if want := "<ActCode>05</ActCode>"; !bytes.Contains(res, []byte(want)) {
+		t.Errorf("response = %s, want %s", res, want)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// Heartbeat and failover counters
+var (
+	heartbeatsAnswered = metrics.NewCounter("heartbeats_answered")
+	heartbeatsSent     = metrics.NewCounter("heartbeats_sent")
+	heartbeatsMissed   = metrics.NewCounter("heartbeats_missed")
+	forwardFailovers   = metrics.NewCounter("forward_failovers")
+)
+
+// heartbeatMiddleware answers the echo messages of listeners with heartbeat
+// ProcCodes locally, without forwarding them.
+func (s *Server) heartbeatMiddleware(next middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		p := s.profile(m.Listener)
+		if p == nil || p.Heartbeat == nil || !slices.Contains(p.Heartbeat.ProcCodes, m.ProcCode) {
+			return next(ctx, m)
+		}
+		heartbeatsAnswered.Add(1)
+		slog.Debug("Heartbeat answered", "listener", p.Name, "procCode", m.ProcCode)
+		echo := transform.Echo(m.Framer.Body(m.Body), p.Heartbeat.ActCode, p.Heartbeat.Description)
+		return m.Framer.Frame(echo), nil
+	}
+}
+
+// heartbeat sends the echo template to the forward upstream addr whenever the
+// session has seen no forward traffic for the heartbeat interval. idle reports
+// the time since the last forward exchange, and exchange sends a message and
+// returns the response, failing with errNoAnswer when the host does not answer
+// within the timeout. An echo left unanswered fails the listener over to its
+// next upstream and moves the session there through redial, which returns the
+// new upstream. The session ends through end when no upstream can be reached.
+func (s *Server) heartbeat(
+	ctx context.Context,
+	p *Profile,
+	addr string,
+	idle func() time.Duration,
+	exchange func(context.Context, *framing.Frame, time.Duration) (*[]byte, error),
+	redial func() (string, error),
+	end func(),
+) {
+	interval := p.Heartbeat.Interval.Duration
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		if wait := interval - idle(); wait > 0 {
+			timer.Reset(wait)
+			continue
+		}
+
+		// The timeout starts once the echo is sent, not while a client exchange is under way
+		res, err := p.forward(p.Framer.Frame(s.echo(p.Heartbeat.Template)), func(msg *[]byte) (*[]byte, error) {
+			return exchange(ctx, p.ForwardFramer.Wrap(*msg), p.Heartbeat.Timeout.Duration)
+		})
+		heartbeatsSent.Add(1)
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, errNoAnswer):
+			heartbeatsMissed.Add(1)
+			slog.Error("Heartbeat unanswered by forward host, failing over",
+				"listener", p.Name, "forward", addr, "timeout", p.Heartbeat.Timeout.Duration)
+			p.failover(addr)
+			next, err := redial()
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Unable to reconnect to a forward host, closing session", "listener", p.Name, "error", err)
+					end()
+				}
+				return
+			}
+			slog.Info("Session moved to forward host", "listener", p.Name, "from", addr, "to", next)
+			addr = next
+		case err != nil:
+			slog.Error("Invalid heartbeat response", "listener", p.Name, "forward", addr, "error", err)
+		default:
+			slog.Debug("Heartbeat answered by forward host", "listener", p.Name, "forward", addr, "bytes", len(*res))
+		}
+		timer.Reset(interval)
+	}
+}
+
+// errNoAnswer is returned by a forward exchange the host did not answer in time
+var errNoAnswer = errors.New("no answer from forward host")
+
+// echo fills in the heartbeat template with a new STAN and the local time.
+func (s *Server) echo(template string) []byte {
+	return []byte(strings.NewReplacer(
+		"${STAN}", s.nextSTAN(),
+		"${DATETIME}", time.Now().Format("0102150405"),
+	).Replace(template))
+}
+
+// upstreams lists the forward upstream followed by the failover upstreams.
+func (p *Profile) upstreams() []string {
+	return append([]string{p.Forward}, p.Failover...)
+}
+
+// dialForward connects to the active forward upstream, moving on to the next
+// upstreams in turn when it cannot be reached. It returns the connection and
+// the configured address it was dialed on.
+func (p *Profile) dialForward(ctx context.Context) (net.Conn, string, error) {
+	hosts := p.upstreams()
+	start := int(p.active.Load())
+	var (
+		dialer net.Dialer
+		errs   []error
+	)
+	for i := range hosts {
+		n := (start + i) % len(hosts)
+		conn, err := dialer.DialContext(ctx, "tcp", hosts[n])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if n != start {
+			p.switchUpstream(start, n)
+		}
+		return conn, hosts[n], nil
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// failover moves the listener off the forward upstream addr once it stopped
+// answering, unless another session already did.
+func (p *Profile) failover(addr string) {
+	hosts := p.upstreams()
+	cur := int(p.active.Load())
+	if len(hosts) < 2 || hosts[cur] != addr {
+		return
+	}
+	p.switchUpstream(cur, (cur+1)%len(hosts))
+}
+
+// switchUpstream makes upstream to the active forward upstream if from still is.
+func (p *Profile) switchUpstream(from, to int) {
+	if !p.active.CompareAndSwap(int32(from), int32(to)) {
+		return
+	}
+	forwardFailovers.Add(1)
+	hosts := p.upstreams()
+	slog.Warn("Forward upstream failed over", "listener", p.Name, "from", hosts[from], "to", hosts[to])
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+// startHost starts a forward host on addr reporting the messages it receives on
+// the returned channel. It answers them with a Reply element when answer is set.
+func startHost(t *testing.T, addr string, answer bool) (string, <-chan string) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan string, 100)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				for {
+					req, err := framing.Read(c)
+					if err != nil {
+						return
+					}
+					select {
+					case received <- string(req[framing.DefaultLengthSize:]):
+					default:
+					}
+					if answer {
+						c.Write(*framing.Default.Frame([]byte("<XML><Reply/></XML>")))
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+// startHeartbeatServer starts a server with a heartbeat listener and connects to it.
+func startHeartbeatServer(t *testing.T, lc config.ListenerConfig) (*Server, func() net.Conn) {
+	cfg := config.Default()
+	cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+	cfg.Listeners = []config.ListenerConfig{lc}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(srv.Stop)
+
+	return srv, func() net.Conn {
+		conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+}
+
+func TestServerHeartbeat(t *testing.T) {
+	forward, received := startHost(t, "127.0.0.1:0", true)
+	_, dial := startHeartbeatServer(t, config.ListenerConfig{
+		Address: "127.0.0.1:0",
+		Forward: forward,
+		Heartbeat: &config.HeartbeatConfig{
+			ProcCodes: []string{"ECHO"},
+			Interval:  config.Duration{Duration: 30 * time.Millisecond},
+			Template:  "<XML><ProcCode>ECHO</ProcCode><STAN>${STAN}</STAN><LocalTxnDtTime>${DATETIME}</LocalTxnDtTime></XML>",
+		},
+	})
+	conn := dial()
+
+	// Echoes from the client are answered locally
+	conn.Write(*framing.Default.Frame([]byte("<XML><ProcCode>ECHO</ProcCode><STAN>5</STAN></XML>")))
+	res, err := framing.Read(conn)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	for _, want := range []string{"<STAN>5</STAN>", "<ActCode>0</ActCode>", "<ActDescription>Echo</ActDescription>"} {
+		if !bytes.Contains(res, []byte(want)) {
+			t.Errorf("echo response = %s, want %s", res, want)
+		}
+	}
+
+	// The idle session sends echoes to the forward host, which never sees the client's
+	for range 2 {
+		select {
+		case msg := <-received:
+			if !strings.Contains(msg, "<ProcCode>ECHO</ProcCode><STAN>0000") || strings.Contains(msg, "${") {
+				t.Errorf("forward host received %s, want a heartbeat", msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no heartbeat received by the forward host")
+		}
+	}
+
+	// Client traffic is still forwarded in between
+	conn.Write(*framing.Default.Frame([]byte("<XML><ProcCode>CRNQ</ProcCode><STAN>6</STAN></XML>")))
+	if res, err := framing.Read(conn); err != nil || !bytes.Contains(res, []byte("<Reply/>")) {
+		t.Errorf("Read() = %s, %v, want the forward response", res, err)
+	}
+}
+
+func TestServerFailover(t *testing.T) {
+	heartbeat := &config.HeartbeatConfig{
+		Interval: config.Duration{Duration: 20 * time.Millisecond},
+		Template: "<XML><ProcCode>ECHO</ProcCode></XML>",
+		Timeout:  config.Duration{Duration: 50 * time.Millisecond},
+	}
+
+	t.Run("unanswered echo", func(t *testing.T) {
+		primary, _ := startHost(t, "127.0.0.1:0", false)
+		backup, received := startHost(t, "127.0.0.1:0", true)
+		srv, dial := startHeartbeatServer(t, config.ListenerConfig{
+			Address: "127.0.0.1:0", Forward: primary, Failover: []string{backup}, Heartbeat: heartbeat,
+		})
+
+		// The session on the silent primary moves to the backup after the first echo
+		conn := dial()
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatal("no heartbeat received by the backup")
+		}
+		if got := srv.profiles[0].upstreams()[srv.profiles[0].active.Load()]; got != backup {
+			t.Errorf("active upstream = %s, want %s", got, backup)
+		}
+
+		// The client connection stays open and is served by the backup
+		conn.Write(*framing.Default.Frame([]byte("<XML><ProcCode>CRNQ</ProcCode></XML>")))
+		if res, err := framing.Read(conn); err != nil || !bytes.Contains(res, []byte("<Reply/>")) {
+			t.Errorf("Read() = %s, %v, want the backup response", res, err)
+		}
+	})
+
+	t.Run("no upstream left", func(t *testing.T) {
+		// The forward host leaves echoes unanswered and stops listening after the first connection
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			c, err := l.Accept()
+			l.Close()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			io.Copy(io.Discard, c)
+		}()
+		_, dial := startHeartbeatServer(t, config.ListenerConfig{
+			Address: "127.0.0.1:0", Forward: l.Addr().String(), Heartbeat: heartbeat,
+		})
+
+		conn := dial()
+		if _, err := io.ReadAll(conn); err != nil {
+			t.Fatalf("ReadAll() error = %v, want the connection closed", err)
+		}
+	})
+
+	t.Run("slow client exchange", func(t *testing.T) {
+		// The primary answers echoes at once and client messages after more than the echo timeout
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			for {
+				req, err := framing.Read(c)
+				if err != nil {
+					return
+				}
+				if !bytes.Contains(req, []byte("ECHO")) {
+					time.Sleep(150 * time.Millisecond)
+				}
+				c.Write(*framing.Default.Frame([]byte("<XML><Reply/></XML>")))
+			}
+		}()
+		backup, _ := startHost(t, "127.0.0.1:0", true)
+		srv, dial := startHeartbeatServer(t, config.ListenerConfig{
+			Address: "127.0.0.1:0", Forward: l.Addr().String(), Failover: []string{backup}, Heartbeat: heartbeat,
+		})
+
+		// The echo waiting behind the client's exchange is not counted as unanswered
+		conn := dial()
+		conn.Write(*framing.Default.Frame([]byte("<XML><ProcCode>CRNQ</ProcCode></XML>")))
+		if res, err := framing.Read(conn); err != nil || !bytes.Contains(res, []byte("<Reply/>")) {
+			t.Fatalf("Read() = %s, %v, want the primary response", res, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if active := srv.profiles[0].active.Load(); active != 0 {
+			t.Errorf("active upstream = %d, want the primary kept", active)
+		}
+	})
+
+	t.Run("unreachable primary", func(t *testing.T) {
+		primary := unusedAddr(t)
+		backup, _ := startHost(t, "127.0.0.1:0", true)
+		_, dial := startHeartbeatServer(t, config.ListenerConfig{
+			Address: "127.0.0.1:0", Forward: primary, Failover: []string{backup},
+		})
+
+		conn := dial()
+		conn.Write(*framing.Default.Frame([]byte("<XML><ProcCode>CRNQ</ProcCode></XML>")))
+		if res, err := framing.Read(conn); err != nil || !bytes.Contains(res, []byte("<Reply/>")) {
+			t.Errorf("Read() = %s, %v, want the backup response", res, err)
+		}
+	})
+}
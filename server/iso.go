@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/andrei-cloud/netfwd/iso8583"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/routing"
+)
+
+// isoSTANMismatches counts forward responses whose STAN differs from the request
+var isoSTANMismatches = metrics.NewCounter("iso_stan_mismatches")
+
+// isoMiddleware handles forward messages of listeners whose upstream speaks ISO 8583.
+// It translates XML messages when configured, otherwise it parses the ISO 8583
+// messages for logging. Either way the response STAN must match the request.
+func (s *Server) isoMiddleware(next middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		p := s.profile(m.Listener)
+		if p == nil || p.ISO == nil || m.Dest != routing.Forward {
+			return next(ctx, m)
+		}
+
+		body := m.Framer.Body(m.Body)
+		if p.TranslateISO {
+			iso, err := p.ISO.ToISO(body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to translate message to ISO 8583: %w", err)
+			}
+			body = iso
+			m.Body = *m.Framer.Frame(iso)
+		}
+
+		req, err := p.ISO.Spec.Unpack(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ISO 8583 request: %w", err)
+		}
+		slog.Info("ISO 8583 request", "mti", req.MTI, "stan", req.STAN())
+
+		response, err := next(ctx, m)
+		if err != nil || response == nil {
+			return response, err
+		}
+
+		resBody := m.Framer.Body(*response)
+		res, err := p.ISO.Spec.Unpack(resBody)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ISO 8583 response: %w", err)
+		}
+		slog.Info("ISO 8583 response", "mti", res.MTI, "stan", res.STAN(), "responseCode", res.Get(39))
+
+		// Responses are read in order, so a different STAN means the link is out of step
+		if res.STAN() != req.STAN() {
+			isoSTANMismatches.Add(1)
+			return nil, fmt.Errorf("ISO 8583 response STAN %q does not match request STAN %q", res.STAN(), req.STAN())
+		}
+
+		if !p.TranslateISO {
+			return response, nil
+		}
+		xmlBody, err := p.ISO.ToXML(resBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to translate ISO 8583 response: %w", err)
+		}
+		return m.Framer.Frame(xmlBody), nil
+	}
+}
+
+// route returns the destination of a client message. ISO 8583 messages passed
+// through untranslated are routed on their parsed MTI and processing code, as
+// a code may also occur by chance inside their other fields.
+func (p *Profile) route(msg []byte) routing.Destination {
+	if p.ISO == nil || p.TranslateISO {
+		dest, _ := p.Routes.Route(msg)
+		return dest
+	}
+	m, err := p.ISO.Spec.Unpack(p.Framer.Body(msg))
+	if err != nil {
+		// Left to the iso8583 middleware to reject
+		return routing.Forward
+	}
+	dest, _ := p.Routes.RouteCodes(m.MTI, m.Get(iso8583.ProcCodeField))
+	return dest
+}
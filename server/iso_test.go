@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/iso8583"
+	"github.com/andrei-cloud/netfwd/routing"
+)
+
+// startISOHost starts a forward host answering ISO 8583 requests with a
+// response MTI and response code 00. A STAN of 999999 is answered with a wrong STAN.
+func startISOHost(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	spec := iso8583.DefaultSpec()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				for {
+					buf, err := framing.Read(c)
+					if err != nil {
+						return
+					}
+					m, err := spec.Unpack(buf[framing.DefaultLengthSize:])
+					if err != nil {
+						return
+					}
+					m.MTI = "0210"
+					m.Set(39, "00")
+					if m.STAN() == "999999" {
+						m.Set(11, "000001")
+					}
+					res, _ := spec.Pack(m)
+					c.Write(*framing.Default.Frame(res))
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestServerISO8583(t *testing.T) {
+	cfg := config.Default()
+	cfg.Forward = startISOHost(t)
+	cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+	cfg.Listeners = []config.ListenerConfig{{
+		Name:    "iso",
+		Address: "127.0.0.1:0",
+		ISO8583: &config.ISO8583Config{Translate: true},
+	}}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "translated",
+			body: `<XML><ProcCode>CRNQ</ProcCode><STAN>000123</STAN><REFNUM>000000000001</REFNUM></XML>`,
+			want: `<XML><MTI>0210</MTI><STAN>000123</STAN><REFNUM>000000000001</REFNUM><ActCode>00</ActCode></XML>`,
+		},
+		{
+			name:    "STAN mismatch closes the connection",
+			body:    `<XML><ProcCode>CRNQ</ProcCode><STAN>999999</STAN></XML>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conn.Write(*framing.Default.Frame([]byte(tt.body))); err != nil {
+				t.Fatal(err)
+			}
+			res, err := framing.Read(conn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(res[framing.DefaultLengthSize:]) != tt.want {
+				t.Errorf("response = %s, want %s", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileRouteISO(t *testing.T) {
+	p, err := NewProfile(config.ListenerConfig{
+		Address:   "127.0.0.1:0",
+		APIRoutes: []string{"CSNQ", "310000"},
+		ISO8583:   &config.ISO8583Config{},
+	}, "127.0.0.1:9000")
+	if err != nil {
+		t.Fatalf("NewProfile() error = %v", err)
+	}
+
+	pack := func(fields map[int]string) []byte {
+		data, err := p.ISO.Spec.Pack(&iso8583.Message{MTI: "0200", Fields: fields})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *p.Framer.Frame(data)
+	}
+	tests := []struct {
+		name string
+		msg  []byte
+		want routing.Destination
+	}{
+		{"processing code", pack(map[int]string{3: "310000", 11: "000001"}), routing.API},
+		{"other processing code", pack(map[int]string{3: "000000", 11: "000001"}), routing.Forward},
+		{"code inside another field", pack(map[int]string{3: "000000", 43: "CSNQ STREET 310000"}), routing.Forward},
+		{"not ISO 8583", *p.Framer.Frame([]byte("CSNQ")), routing.Forward},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.route(tt.msg); got != tt.want {
+				t.Errorf("route() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/limit"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// Limit metrics
+var (
+	rateLimitedMessages = metrics.NewCounter("rate_limited_messages")
+	rejectedConnections = metrics.NewCounter("rejected_connections")
+)
+
+// idleBucketTTL is how long an unused per-client bucket is kept
+const idleBucketTTL = 10 * time.Minute
+
+// Limits enforces rate limits per client and ProcCode and the concurrent
+// connections cap on the listeners.
+type Limits struct {
+	cfg config.LimitsConfig
+
+	mu        sync.Mutex
+	clients   map[string]*limit.TokenBucket
+	procCodes map[string]*limit.TokenBucket
+	lastPrune time.Time
+
+	conns limit.Semaphore
+}
+
+// NewLimits creates limits from their configuration.
+func NewLimits(cfg config.LimitsConfig) *Limits {
+	l := &Limits{
+		cfg:       cfg,
+		clients:   make(map[string]*limit.TokenBucket),
+		procCodes: make(map[string]*limit.TokenBucket),
+		lastPrune: time.Now(),
+	}
+	for code, rc := range cfg.ProcCodeRate {
+		if rc.Rate <= 0 {
+			continue // unlimited
+		}
+		l.procCodes[code] = limit.NewTokenBucket(rc.Rate, rc.Burst)
+	}
+	if cfg.MaxConnections > 0 {
+		l.conns = limit.NewSemaphore(cfg.MaxConnections)
+	}
+	return l
+}
+
+// clientBucket returns the bucket of a client IP, creating it on first use.
+func (l *Limits) clientBucket(ip string) *limit.TokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastPrune) > idleBucketTTL {
+		for k, b := range l.clients {
+			if b.Idle(now, idleBucketTTL) {
+				delete(l.clients, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	b, ok := l.clients[ip]
+	if !ok {
+		b = limit.NewTokenBucket(l.cfg.ClientRate.Rate, l.cfg.ClientRate.Burst)
+		l.clients[ip] = b
+	}
+	return b
+}
+
+// CheckMessage applies the client and ProcCode rate limits to one message.
+// It returns an empty policy when the message may proceed, possibly after queueing.
+func (l *Limits) CheckMessage(ctx context.Context, ip, procCode string) limit.Policy {
+	if l.cfg.ClientRate.Rate > 0 {
+		if p := l.take(ctx, l.clientBucket(ip), l.cfg.ClientRate.Policy); p != "" {
+			return p
+		}
+	}
+	if b, ok := l.procCodes[procCode]; ok {
+		if p := l.take(ctx, b, l.cfg.ProcCodeRate[procCode].Policy); p != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+// take consumes a token from b, applying the policy when none is available.
+func (l *Limits) take(ctx context.Context, b *limit.TokenBucket, policy limit.Policy) limit.Policy {
+	if b.Allow() {
+		return ""
+	}
+
+	rateLimitedMessages.Add(1)
+	switch policy {
+	case limit.Queue:
+		if err := b.Wait(ctx); err != nil {
+			return limit.Close
+		}
+		return ""
+	case limit.Close:
+		return limit.Close
+	default:
+		return limit.Decline
+	}
+}
+
+// AcquireConnection takes a listener connection slot.
+// Under the queue policy it blocks until a slot is free.
+func (l *Limits) AcquireConnection(ctx context.Context) bool {
+	if l.conns == nil {
+		return true
+	}
+	if l.cfg.ConnectionPolicy == limit.Queue {
+		return l.conns.Acquire(ctx) == nil
+	}
+	if l.conns.TryAcquire() {
+		return true
+	}
+	rejectedConnections.Add(1)
+	return false
+}
+
+// ReleaseConnection frees a listener connection slot.
+func (l *Limits) ReleaseConnection() {
+	if l.conns != nil {
+		l.conns.Release()
+	}
+}
+
+// Middleware applies the rate limits to each message, answering with the
+// decline XML or closing the connection when a limit is exceeded.
+func (l *Limits) Middleware(next middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		switch l.CheckMessage(ctx, clientIP(m.RemoteAddr), m.ProcCode) {
+		case limit.Decline:
+			slog.Warn("Rate limit exceeded, declining message", "remoteAddr", m.RemoteAddr.String())
+			return m.Framer.Frame(transform.Decline(m.Body, l.cfg.DeclineCode, l.cfg.DeclineDescription)), nil
+		case limit.Close:
+			slog.Warn("Rate limit exceeded, closing connection", "remoteAddr", m.RemoteAddr.String())
+			return nil, middleware.ErrCloseConnection
+		}
+		return next(ctx, m)
+	}
+}
+
+// clientIP returns the host part of a network address.
+func clientIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/limit"
+)
+
+func TestLimitsCheckMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.LimitsConfig
+		want limit.Policy
+	}{
+		{
+			"client decline",
+			config.LimitsConfig{ClientRate: config.RateConfig{Rate: 0.001, Burst: 1, Policy: limit.Decline}},
+			limit.Decline,
+		},
+		{
+			"proc code close",
+			config.LimitsConfig{ProcCodeRate: map[string]config.RateConfig{"CSNQ": {Rate: 0.001, Burst: 1, Policy: limit.Close}}},
+			limit.Close,
+		},
+		{
+			"zero rate unlimited",
+			config.LimitsConfig{ProcCodeRate: map[string]config.RateConfig{"CSNQ": {Rate: 0, Burst: 1, Policy: limit.Close}}},
+			"",
+		},
+		{
+			"other proc code unlimited",
+			config.LimitsConfig{ProcCodeRate: map[string]config.RateConfig{"CRNQ": {Rate: 0.001, Burst: 1, Policy: limit.Close}}},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimits(tt.cfg)
+			if got := l.CheckMessage(context.Background(), "10.0.0.1", "CSNQ"); got != "" {
+				t.Fatalf("CheckMessage() first message = %q, want allowed", got)
+			}
+			if got := l.CheckMessage(context.Background(), "10.0.0.1", "CSNQ"); got != tt.want {
+				t.Errorf("CheckMessage() = %q, want %q", got, tt.want)
+			}
+			// Other clients have their own bucket
+			if tt.cfg.ClientRate.Rate > 0 {
+				if got := l.CheckMessage(context.Background(), "10.0.0.2", "CSNQ"); got != "" {
+					t.Errorf("CheckMessage() other client = %q, want allowed", got)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitsConnections(t *testing.T) {
+	l := NewLimits(config.LimitsConfig{MaxConnections: 1, ConnectionPolicy: limit.Close})
+
+	if !l.AcquireConnection(context.Background()) {
+		t.Fatalf("AcquireConnection() expected first connection to pass")
+	}
+	if l.AcquireConnection(context.Background()) {
+		t.Errorf("AcquireConnection() expected second connection to be refused")
+	}
+	l.ReleaseConnection()
+	if !l.AcquireConnection(context.Background()) {
+		t.Errorf("AcquireConnection() expected slot after release")
+	}
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/charset"
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/iso8583"
+	"github.com/andrei-cloud/netfwd/routing"
+)
+
+// unixPrefix marks listener addresses that are Unix domain socket paths
+const unixPrefix = "unix:"
+
+// Profile is an inbound listener and the settings applied to its connections.
+type Profile struct {
+	Name    string
+	Network string         // "tcp" or "unix"
+	Address string         // host:port or socket path
+	Forward string         // forward upstream for messages not handled by the API
+	Routes  routing.Table  // ProcCodes routed to the HTTP API
+	Framer  framing.Framer // framing used with the client
+	TLS     *tls.Config    // nil for plain connections
+
+	ForwardFramer framing.Framer // framing used with the forward upstream
+
+	Oversize            string // policy for client messages over Framer.MaxSize
+	Resync              bool   // recover from invalid client length prefixes
+	OversizeCode        string // action code answering skipped messages
+	OversizeDescription string
+
+	ISO          *iso8583.Translator // nil when the forward upstream does not speak ISO 8583
+	TranslateISO bool                // translate XML messages to ISO 8583 for the forward upstream
+
+	Gateway *config.GatewayConfig // nil for framed TCP clients
+
+	Charset        *charset.Charset // default character set of client messages
+	ForwardCharset *charset.Charset // default character set of forward upstream messages
+
+	Failover  []string                // backup forward upstreams
+	Heartbeat *config.HeartbeatConfig // nil when echo messages are not handled
+	active    atomic.Int32            // index of the forward upstream in use, 0 for Forward
+}
+
+// defaultISOFields maps the XML identity tags when no ISO 8583 field mapping is configured
+var defaultISOFields = map[int]string{
+	7:  "LocalTxnDtTime",
+	11: "STAN",
+	37: "REFNUM",
+	39: "ActCode",
+}
+
+// NewProfile builds a listener profile from its configuration,
+// using defaultForward when the listener has no forward upstream of its own.
+func NewProfile(cfg config.ListenerConfig, defaultForward string) (*Profile, error) {
+	p := &Profile{
+		Name:    cfg.Name,
+		Network: "tcp",
+		Address: cfg.Address,
+		Forward: cfg.Forward,
+		Routes:  routing.Table{APIRoutes: cfg.APIRoutes},
+		Framer: framing.Framer{
+			Mode:        cfg.Framing.Mode,
+			LengthSize:  cfg.Framing.LengthSize,
+			MaxSize:     cfg.Framing.MaxSize,
+			ResyncLimit: cfg.Framing.ResyncLimit,
+			Delimiter:   cfg.Framing.Delimiter,
+		},
+
+		Oversize:            cfg.Framing.Oversize,
+		Resync:              cfg.Framing.Resync,
+		OversizeCode:        cfg.Framing.DeclineCode,
+		OversizeDescription: cfg.Framing.DeclineDescription,
+	}
+
+	if p.Address == "" {
+		return nil, errors.New("listener address is required")
+	}
+	if path, ok := strings.CutPrefix(p.Address, unixPrefix); ok {
+		p.Network, p.Address = "unix", path
+	} else if _, _, err := net.SplitHostPort(p.Address); err != nil {
+		return nil, fmt.Errorf("listener %q address is invalid: %w", p.Name, err)
+	}
+	if p.Name == "" {
+		p.Name = cfg.Address
+	}
+
+	if p.Forward == "" {
+		p.Forward = defaultForward
+	}
+	if _, _, err := net.SplitHostPort(p.Forward); err != nil {
+		return nil, fmt.Errorf("listener %q forward address is invalid: %w", p.Name, err)
+	}
+
+	var err error
+	if p.Charset, err = charset.Lookup(cfg.Charset); err != nil {
+		return nil, fmt.Errorf("listener %q: %w", p.Name, err)
+	}
+	if p.ForwardCharset, err = charset.Lookup(cfg.ForwardCharset); err != nil {
+		return nil, fmt.Errorf("listener %q forward: %w", p.Name, err)
+	}
+
+	if p.Routes.APIRoutes == nil {
+		p.Routes.APIRoutes = []string{"CSNQ"}
+	}
+	if p.Framer.LengthSize <= 0 {
+		p.Framer.LengthSize = framing.DefaultLengthSize
+	}
+	p.ForwardFramer = framing.Framer{
+		Mode:       cmp.Or(cfg.Framing.ForwardMode, p.Framer.Mode),
+		LengthSize: cmp.Or(cfg.Framing.ForwardLengthSize, p.Framer.LengthSize),
+		MaxSize:    cfg.Framing.ForwardMaxSize,
+		Delimiter:  cmp.Or(cfg.Framing.ForwardDelimiter, p.Framer.Delimiter),
+	}
+	if err := p.Framer.Validate(); err != nil {
+		return nil, fmt.Errorf("listener %q: %w", p.Name, err)
+	}
+	if err := p.ForwardFramer.Validate(); err != nil {
+		return nil, fmt.Errorf("listener %q forward: %w", p.Name, err)
+	}
+
+	switch p.Oversize {
+	case "":
+		p.Oversize = config.OversizeClose
+	case config.OversizeClose, config.OversizeSkip, config.OversizeResync:
+	default:
+		return nil, fmt.Errorf("listener %q: unknown oversize policy %q", p.Name, p.Oversize)
+	}
+	if !p.Framer.Prefixed() && (p.Oversize != config.OversizeClose || p.Resync) {
+		return nil, fmt.Errorf("listener %q: oversize policy %q and resync require length-prefixed framing", p.Name, p.Oversize)
+	}
+	if p.OversizeCode == "" {
+		p.OversizeCode = "30"
+	}
+	if p.OversizeDescription == "" {
+		p.OversizeDescription = "Message too large"
+	}
+
+	if cfg.TLS != nil {
+		tlsConfig, err := loadTLSConfig(*cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("listener %q: %w", p.Name, err)
+		}
+		p.TLS = tlsConfig
+	}
+
+	if cfg.ISO8583 != nil {
+		iso, err := newTranslator(*cfg.ISO8583)
+		if err != nil {
+			return nil, fmt.Errorf("listener %q: %w", p.Name, err)
+		}
+		p.ISO, p.TranslateISO = iso, cfg.ISO8583.Translate
+		if p.ForwardFramer.Mode == framing.XMLDocument {
+			return nil, fmt.Errorf("listener %q: ISO 8583 upstreams cannot use XML document framing", p.Name)
+		}
+	}
+
+	for _, addr := range cfg.Failover {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("listener %q failover address is invalid: %w", p.Name, err)
+		}
+	}
+	p.Failover = cfg.Failover
+
+	if cfg.Heartbeat != nil {
+		hb := *cfg.Heartbeat
+		if hb.ActCode == "" {
+			hb.ActCode = "0"
+		}
+		if hb.Description == "" {
+			hb.Description = "Echo"
+		}
+		if hb.Interval.Duration > 0 && hb.Template == "" {
+			return nil, fmt.Errorf("listener %q: heartbeat interval requires a template", p.Name)
+		}
+		if hb.Timeout.Duration <= 0 {
+			hb.Timeout.Duration = 10 * time.Second
+		}
+		p.Heartbeat = &hb
+	}
+
+	if cfg.Gateway != nil {
+		gw := *cfg.Gateway
+		if gw.PoolSize <= 0 {
+			gw.PoolSize = 4
+		}
+		if gw.Timeout.Duration <= 0 {
+			gw.Timeout.Duration = 30 * time.Second
+		}
+		p.Gateway = &gw
+	}
+
+	return p, nil
+}
+
+// profile returns the listener profile with the given name.
+func (s *Server) profile(name string) *Profile {
+	for _, p := range s.profiles {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// newTranslator creates the ISO 8583 translator of a forward upstream.
+func newTranslator(cfg config.ISO8583Config) (*iso8583.Translator, error) {
+	t := &iso8583.Translator{
+		Spec:   iso8583.DefaultSpec(),
+		MTITag: cfg.MTITag,
+		MTI:    cfg.MTI,
+		Fields: cfg.Fields,
+	}
+	if cfg.Spec != "" {
+		spec, err := iso8583.LoadSpec(cfg.Spec)
+		if err != nil {
+			return nil, err
+		}
+		t.Spec = spec
+	}
+	if t.MTITag == "" {
+		t.MTITag = "MTI"
+	}
+	if t.MTI == "" {
+		t.MTI = "0200"
+	}
+	if t.Fields == nil {
+		t.Fields = defaultISOFields
+	}
+	for n := range t.Fields {
+		if _, ok := t.Spec.Fields[n]; !ok {
+			return nil, fmt.Errorf("ISO 8583 field %d is not in the spec", n)
+		}
+	}
+	return t, nil
+}
+
+// Listen opens the listener socket. A stale Unix socket file, which no process
+// accepts on, is removed first; a socket still in use is an error.
+func (p *Profile) Listen() (net.Listener, error) {
+	if p.Network == "unix" {
+		if fi, err := os.Stat(p.Address); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+			// Only a socket nobody accepts on is stale
+			if conn, err := net.DialTimeout("unix", p.Address, time.Second); err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("socket %s is in use by another process", p.Address)
+			}
+			if err := os.Remove(p.Address); err != nil {
+				return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+			}
+		}
+	}
+	return net.Listen(p.Network, p.Address)
+}
+
+// loadTLSConfig creates a server TLS configuration, requiring client
+// certificates when a client CA is given.
+func loadTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in client CA file")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
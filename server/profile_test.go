@@ -0,0 +1,197 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/charset"
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/routing"
+)
+
+func TestNewProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ListenerConfig
+		want    *Profile
+		wantErr bool
+	}{
+		{
+			"defaults",
+			config.ListenerConfig{Address: ":3000"},
+			&Profile{
+				Name:    ":3000",
+				Network: "tcp",
+				Address: ":3000",
+				Forward: ":9002",
+				Routes:  routing.Table{APIRoutes: []string{"CSNQ"}},
+				Framer:  framing.Framer{LengthSize: 5},
+
+				ForwardFramer:       framing.Framer{LengthSize: 5},
+				Oversize:            config.OversizeClose,
+				OversizeCode:        "30",
+				OversizeDescription: "Message too large",
+
+				Charset:        charset.UTF8,
+				ForwardCharset: charset.UTF8,
+			},
+			false,
+		},
+		{
+			"unix socket",
+			config.ListenerConfig{Name: "pos", Address: "unix:/tmp/netfwd.sock", Forward: "10.0.0.1:9100",
+				APIRoutes: []string{}, Framing: config.FramingConfig{LengthSize: 4}},
+			&Profile{
+				Name:    "pos",
+				Network: "unix",
+				Address: "/tmp/netfwd.sock",
+				Forward: "10.0.0.1:9100",
+				Routes:  routing.Table{APIRoutes: []string{}},
+				Framer:  framing.Framer{LengthSize: 4},
+
+				ForwardFramer:       framing.Framer{LengthSize: 4},
+				Oversize:            config.OversizeClose,
+				OversizeCode:        "30",
+				OversizeDescription: "Message too large",
+
+				Charset:        charset.UTF8,
+				ForwardCharset: charset.UTF8,
+			},
+			false,
+		},
+		{
+			"delimited client and XML documents forward",
+			config.ListenerConfig{Address: ":3000", Framing: config.FramingConfig{
+				Mode: framing.Delimited, Delimiter: "\x03", ForwardMode: framing.XMLDocument}},
+			&Profile{
+				Name:    ":3000",
+				Network: "tcp",
+				Address: ":3000",
+				Forward: ":9002",
+				Routes:  routing.Table{APIRoutes: []string{"CSNQ"}},
+				Framer:  framing.Framer{Mode: framing.Delimited, LengthSize: 5, Delimiter: "\x03"},
+
+				ForwardFramer:       framing.Framer{Mode: framing.XMLDocument, LengthSize: 5, Delimiter: "\x03"},
+				Oversize:            config.OversizeClose,
+				OversizeCode:        "30",
+				OversizeDescription: "Message too large",
+
+				Charset:        charset.UTF8,
+				ForwardCharset: charset.UTF8,
+			},
+			false,
+		},
+		{
+			"heartbeat and failover",
+			config.ListenerConfig{Address: ":3000", Failover: []string{"10.0.0.2:9002"},
+				Heartbeat: &config.HeartbeatConfig{ProcCodes: []string{"ECHO"}}},
+			&Profile{
+				Name:    ":3000",
+				Network: "tcp",
+				Address: ":3000",
+				Forward: ":9002",
+				Routes:  routing.Table{APIRoutes: []string{"CSNQ"}},
+				Framer:  framing.Framer{LengthSize: 5},
+
+				ForwardFramer:       framing.Framer{LengthSize: 5},
+				Oversize:            config.OversizeClose,
+				OversizeCode:        "30",
+				OversizeDescription: "Message too large",
+
+				Charset:        charset.UTF8,
+				ForwardCharset: charset.UTF8,
+
+				Failover: []string{"10.0.0.2:9002"},
+				Heartbeat: &config.HeartbeatConfig{ProcCodes: []string{"ECHO"}, ActCode: "0", Description: "Echo",
+					Timeout: config.Duration{Duration: 10 * time.Second}},
+			},
+			false,
+		},
+		{"missing address", config.ListenerConfig{}, nil, true},
+		{"invalid failover", config.ListenerConfig{Address: ":3000", Failover: []string{"nohost"}}, nil, true},
+		{"heartbeat interval without template", config.ListenerConfig{Address: ":3000",
+			Heartbeat: &config.HeartbeatConfig{Interval: config.Duration{Duration: time.Minute}}}, nil, true},
+		{"unknown framing mode", config.ListenerConfig{Address: ":3000",
+			Framing: config.FramingConfig{Mode: "stx"}}, nil, true},
+		{"missing delimiter", config.ListenerConfig{Address: ":3000",
+			Framing: config.FramingConfig{ForwardMode: framing.Delimited}}, nil, true},
+		{"resync without length prefix", config.ListenerConfig{Address: ":3000",
+			Framing: config.FramingConfig{Mode: framing.XMLDocument, Resync: true}}, nil, true},
+		{"invalid forward", config.ListenerConfig{Address: ":3000", Forward: "nohost"}, nil, true},
+		{"unknown oversize policy", config.ListenerConfig{Address: ":3000",
+			Framing: config.FramingConfig{Oversize: "truncate"}}, nil, true},
+		{"unsupported charset", config.ListenerConfig{Address: ":3000", Charset: "koi8-r"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewProfile(tt.cfg, ":9002")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewProfile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netfwd.sock")
+	p, err := NewProfile(config.ListenerConfig{Name: "pos", Address: "unix:" + path}, "10.0.0.1:9100")
+	if err != nil {
+		t.Fatalf("NewProfile() error = %v", err)
+	}
+
+	// A socket left behind by a crashed process is replaced
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := p.Listen()
+	if err != nil {
+		t.Fatalf("Listen() over a stale socket error = %v", err)
+	}
+	defer l.Close()
+
+	// A socket in use is left alone
+	if second, err := p.Listen(); err == nil {
+		second.Close()
+		t.Error("Listen() over a socket in use succeeded, want error")
+	}
+	if conn, err := net.Dial("unix", path); err != nil {
+		t.Errorf("Dial() after the refused Listen() error = %v, want the first listener intact", err)
+	} else {
+		conn.Close()
+	}
+}
+
+func TestNewListenerNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		listeners []config.ListenerConfig
+		wantErr   bool
+	}{
+		{"unique", []config.ListenerConfig{{Name: "atm", Address: "127.0.0.1:0"}, {Name: "pos", Address: "127.0.0.1:0"}}, false},
+		{"single unnamed", []config.ListenerConfig{{Address: "127.0.0.1:0"}}, false},
+		{"duplicate", []config.ListenerConfig{{Name: "atm", Address: "127.0.0.1:0"}, {Name: "atm", Address: "127.0.0.1:0"}}, true},
+		{"unnamed among several", []config.ListenerConfig{{Name: "atm", Address: "127.0.0.1:0"}, {Address: "127.0.0.1:0"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+			cfg.Listeners = tt.listeners
+			if _, err := New(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
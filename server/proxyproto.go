@@ -0,0 +1,266 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/metrics"
+)
+
+// PROXY protocol constants
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107 // including CRLF
+	proxyV2HeaderLen = 16
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyHeaderRejected counts trusted connections without a valid PROXY header
+var proxyHeaderRejected = metrics.NewCounter("proxy_header_rejected")
+
+// errNoProxyHeader is returned when a trusted source does not send a PROXY header
+var errNoProxyHeader = errors.New("missing PROXY protocol header")
+
+// proxyConn is a connection whose remote address was taken from a PROXY protocol header.
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+// Read reads from the buffered reader, which may hold bytes received after the header.
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the original client address.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remote == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remote
+}
+
+// proxyListener reads the PROXY header of accepted connections on their first
+// use, so that a peer slow to send it does not hold up Accept.
+type proxyListener struct {
+	net.Listener
+	proxy *ProxyProtocol
+}
+
+// Accept implements net.Listener.
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &lazyProxyConn{Conn: conn, proxy: l.proxy}, nil
+}
+
+// lazyProxyConn is a connection whose PROXY header has not been read yet.
+type lazyProxyConn struct {
+	net.Conn
+	proxy   *ProxyProtocol
+	once    sync.Once
+	wrapped net.Conn
+	err     error
+}
+
+// header reads the PROXY header once. On failure the connection is closed.
+func (c *lazyProxyConn) header() {
+	c.once.Do(func() {
+		if c.wrapped, c.err = c.proxy.Wrap(c.Conn); c.err != nil {
+			slog.Warn("Invalid PROXY protocol header, closing connection",
+				"peerAddr", c.Conn.RemoteAddr().String(), "error", c.err)
+			closeConn(c.Conn)
+		}
+	})
+}
+
+// Read implements net.Conn.
+func (c *lazyProxyConn) Read(b []byte) (int, error) {
+	if c.header(); c.err != nil {
+		return 0, c.err
+	}
+	return c.wrapped.Read(b)
+}
+
+// RemoteAddr returns the client address from the PROXY header, or the peer
+// address when the header was not sent or is invalid.
+func (c *lazyProxyConn) RemoteAddr() net.Addr {
+	if c.header(); c.err != nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.wrapped.RemoteAddr()
+}
+
+// ProxyProtocol accepts PROXY protocol v1 and v2 headers from trusted sources.
+type ProxyProtocol struct {
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+// NewProxyProtocol creates a PROXY protocol handler. At least one trusted
+// source is required, since any peer sending a header can choose its address.
+func NewProxyProtocol(cfg config.ProxyProtocolConfig) (*ProxyProtocol, error) {
+	trusted, err := parseNets(cfg.Trusted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted sources: %w", err)
+	}
+	if len(trusted) == 0 {
+		return nil, errors.New("PROXY protocol requires trusted sources")
+	}
+	return &ProxyProtocol{trusted: trusted, timeout: cfg.Timeout.Duration}, nil
+}
+
+// trusts reports whether the peer may send a PROXY header.
+func (p *ProxyProtocol) trusts(addr net.Addr) bool {
+	ip := net.ParseIP(clientIP(addr))
+	for _, n := range p.trusted {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap reads the PROXY header from a trusted peer and returns a connection
+// reporting the original client address. Untrusted peers are returned unchanged.
+func (p *ProxyProtocol) Wrap(conn net.Conn) (net.Conn, error) {
+	if !p.trusts(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	if p.timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(p.timeout)); err != nil {
+			return nil, err
+		}
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	r := bufio.NewReader(conn)
+	remote, err := readProxyHeader(r)
+	if err != nil {
+		proxyHeaderRejected.Add(1)
+		return nil, err
+	}
+
+	return &proxyConn{Conn: conn, r: r, remote: remote}, nil
+}
+
+// readProxyHeader parses a v1 or v2 header. A nil address means the
+// sender asked for its own address to be used (LOCAL / UNKNOWN).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(sig, proxyV2Signature):
+		return readProxyV2(r)
+	case bytes.HasPrefix(sig, []byte(proxyV1Prefix)):
+		return readProxyV1(r)
+	default:
+		return nil, errNoProxyHeader
+	}
+}
+
+// readProxyV1 parses a text header such as "PROXY TCP4 192.0.2.1 192.0.2.2 56324 3000\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PROXY v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY v1 header too long or not terminated")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid PROXY v1 source address %q", fields[2])
+	}
+	port, err := strconv.Atoi(fields[4])
+	if err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid PROXY v1 source port %q", fields[4])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 parses a binary header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, proxyV2HeaderLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 header: %w", err)
+	}
+
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", hdr[12]>>4)
+	}
+	command := hdr[12] & 0x0f
+	family := hdr[13]
+
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 addresses: %w", err)
+	}
+
+	// LOCAL connections (health checks) keep the peer address
+	if command == 0 {
+		return nil, nil
+	}
+	if command != 1 {
+		return nil, fmt.Errorf("unsupported PROXY v2 command %d", command)
+	}
+
+	switch family {
+	case 0x11, 0x12: // TCP or UDP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("short PROXY v2 IPv4 address block")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:10])),
+		}, nil
+	case 0x21, 0x22: // TCP or UDP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("short PROXY v2 IPv6 address block")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34])),
+		}, nil
+	default:
+		// Unix sockets and unspecified families keep the peer address
+		return nil, nil
+	}
+}
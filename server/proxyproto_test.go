@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := append([]byte{}, proxyV2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0x00, 0x0c, // PROXY, TCP4, 12 bytes
+		192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0x0b, 0xb8)
+
+	v2Local := append([]byte{}, proxyV2Signature...)
+	v2Local = append(v2Local, 0x20, 0x00, 0x00, 0x00)
+
+	tests := []struct {
+		name    string
+		header  []byte
+		want    string
+		wantErr bool
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 3000\r\n"), "192.0.2.1:56324", false},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 4000 3000\r\n"), "[2001:db8::1]:4000", false},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 malformed", []byte("PROXY TCP4 192.0.2.1\r\n"), "", true},
+		{"v2 tcp4", v2, "192.0.2.1:56324", false},
+		{"v2 local", v2Local, "", false},
+		{"no header", []byte("00264<XML></XML>"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := append(append([]byte{}, tt.header...), []byte("00005hello")...)
+			r := bufio.NewReader(bytes.NewReader(payload))
+
+			addr, err := readProxyHeader(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readProxyHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("readProxyHeader() = %q, want %q", got, tt.want)
+			}
+
+			// The message following the header must be left intact
+			rest, _ := io.ReadAll(r)
+			if string(rest) != "00005hello" {
+				t.Errorf("remaining data = %q, want %q", rest, "00005hello")
+			}
+		})
+	}
+}
+
+func TestNewProxyProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		wantErr bool
+	}{
+		{"trusted network", []string{"10.0.0.0/8"}, false},
+		{"no trusted sources", nil, true},
+		{"invalid source", []string{"not-an-ip"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProxyProtocol(config.ProxyProtocolConfig{Enabled: true, Trusted: tt.trusted})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewProxyProtocol() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProxyProtocolWrap(t *testing.T) {
+	p, err := NewProxyProtocol(config.ProxyProtocolConfig{Trusted: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("NewProxyProtocol() error = %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("PROXY TCP4 203.0.113.7 192.0.2.2 1234 3000\r\n00005hello"))
+	}()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	wrapped, err := p.Wrap(conn)
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	if got := wrapped.RemoteAddr().String(); got != "203.0.113.7:1234" {
+		t.Errorf("RemoteAddr() = %q, want %q", got, "203.0.113.7:1234")
+	}
+
+	msg, err := framing.Read(wrapped)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if string(msg) != "00005hello" {
+		t.Errorf("Read() = %q, want %q", msg, "00005hello")
+	}
+}
@@ -0,0 +1,383 @@
+// Package server accepts client connections and bridges their messages to the
+// forward TCP host or the customer HTTP API.
+//
+// A Server can be embedded in other programs:
+//
+//	cfg := config.Default()
+//	cfg.API.Username, cfg.API.Password = "user", "secret"
+//	srv, err := server.New(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	if err := srv.Start(ctx); err != nil {
+//		return err
+//	}
+//	defer srv.Stop()
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/upstream"
+)
+
+// Server is a netfwd instance serving one or more listeners.
+type Server struct {
+	cfg      *config.Config
+	api      *upstream.API
+	profiles []*Profile
+
+	acl    atomic.Pointer[ACL] // swapped on Reload
+	proxy  *ProxyProtocol      // nil when PROXY protocol is disabled
+	limits *Limits             // nil when no limits are configured
+	valid  *Validator          // request validation rules
+	sf     *StoreForward       // nil when store and forward is disabled
+	dl     *DeadLetter         // nil when dead letters are disabled
+	dups   *Duplicates         // nil when duplicate detection is disabled
+
+	stan atomic.Uint32 // last STAN generated for gateway requests
+
+	sessionID atomic.Uint64       // last client session ID
+	sessions  map[uint64]*Session // open client sessions, guarded by mu
+
+	middleware map[string]middleware.Middleware // available middleware by name
+	chain      []middleware.Middleware          // configured middleware, built by Start
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	stopped   bool
+	wg        sync.WaitGroup
+}
+
+// New validates the configuration and creates a server. Listeners are opened by Start.
+func New(cfg *config.Config) (*Server, error) {
+	api, err := upstream.NewAPI(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := NewValidator(cfg.Validation)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		api:      api,
+		valid:    valid,
+		conns:    make(map[net.Conn]struct{}),
+		sessions: make(map[uint64]*Session),
+	}
+	s.middleware = map[string]middleware.Middleware{
+		"heartbeat":  s.heartbeatMiddleware,
+		"logging":    middleware.Logging,
+		"limits":     s.limitsMiddleware,
+		"validation": valid.Middleware,
+		"duplicates": s.duplicatesMiddleware,
+		"deadletter": s.deadLetterMiddleware,
+		"iso8583":    s.isoMiddleware,
+
+		"storeforward": s.storeForwardMiddleware,
+	}
+
+	// Build listener profiles, defaulting to a single listener on cfg.Listen
+	listeners := cfg.Listeners
+	if len(listeners) == 0 {
+		listeners = []config.ListenerConfig{{Name: "default", Address: cfg.Listen}}
+	}
+	// Profiles are looked up by name, e.g. by middleware and resubmitted dead letters
+	names := make(map[string]bool, len(listeners))
+	for _, lc := range listeners {
+		if lc.Name == "" && len(listeners) > 1 {
+			return nil, fmt.Errorf("listener on %s has no name", lc.Address)
+		}
+		if names[lc.Name] {
+			return nil, fmt.Errorf("duplicate listener name %q", lc.Name)
+		}
+		names[lc.Name] = true
+	}
+	for _, lc := range listeners {
+		if lc.APIRoutes == nil {
+			lc.APIRoutes = apiRoutes(cfg.API)
+		}
+		p, err := NewProfile(lc, cfg.Forward)
+		if err != nil {
+			return nil, err
+		}
+		s.profiles = append(s.profiles, p)
+	}
+
+	if cfg.StoreForward != nil {
+		if s.sf, err = NewStoreForward(*cfg.StoreForward, s.profile); err != nil {
+			return nil, err
+		}
+		slog.Info("Store and forward enabled", "dir", cfg.StoreForward.Dir, "ack", s.sf.cfg.Ack)
+	}
+
+	if cfg.DeadLetter != nil {
+		if s.dl, err = NewDeadLetter(*cfg.DeadLetter); err != nil {
+			return nil, err
+		}
+		slog.Info("Dead letters enabled", "dir", cfg.DeadLetter.Dir)
+	}
+
+	if cfg.Duplicates != nil {
+		if s.dups, err = NewDuplicates(*cfg.Duplicates); err != nil {
+			return nil, err
+		}
+		slog.Info("Duplicate detection enabled", "window", s.dups.cfg.Window.Duration,
+			"keyFields", s.dups.cfg.KeyFields, "action", s.dups.cfg.Action)
+	}
+
+	acl, err := NewACL(cfg.ACL)
+	if err != nil {
+		return nil, err
+	}
+	s.acl.Store(acl)
+
+	if cfg.ProxyProtocol.Enabled {
+		if s.proxy, err = NewProxyProtocol(cfg.ProxyProtocol); err != nil {
+			return nil, err
+		}
+		slog.Info("PROXY protocol enabled", "trusted", cfg.ProxyProtocol.Trusted)
+	}
+
+	if cfg.Limits.Enabled() {
+		s.limits = NewLimits(cfg.Limits)
+		slog.Info("Rate and concurrency limits enabled",
+			"maxConnections", cfg.Limits.MaxConnections,
+			"maxAPIRequests", cfg.Limits.MaxAPIRequests)
+	}
+
+	if err := s.checkMiddleware(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// checkMiddleware fails when a feature is configured but its middleware is
+// missing from the middleware list, which would silently turn the feature off.
+func (s *Server) checkMiddleware() error {
+	rateLimits := s.cfg.Limits.ClientRate.Rate > 0
+	for _, rc := range s.cfg.Limits.ProcCodeRate {
+		rateLimits = rateLimits || rc.Rate > 0
+	}
+	var iso, heartbeat bool
+	for _, p := range s.profiles {
+		iso = iso || p.ISO != nil
+		heartbeat = heartbeat || p.Heartbeat != nil && len(p.Heartbeat.ProcCodes) > 0
+	}
+
+	features := []struct {
+		name       string
+		feature    string
+		configured bool
+	}{
+		{"heartbeat", "heartbeat procCodes", heartbeat},
+		{"limits", "rate limits", rateLimits},
+		{"validation", "validation rules", len(s.cfg.Validation.Rules) > 0},
+		{"duplicates", "duplicate detection", s.dups != nil},
+		{"deadletter", "dead letters", s.dl != nil},
+		{"iso8583", "an ISO 8583 listener", iso},
+		{"storeforward", "store and forward", s.sf != nil},
+	}
+	for _, f := range features {
+		if f.configured && !slices.Contains(s.cfg.Middleware, f.name) {
+			return fmt.Errorf("%s configured but middleware %q is not in the middleware list", f.feature, f.name)
+		}
+	}
+	return nil
+}
+
+// apiRoutes lists the ProcCodes handled by the API when a listener does not:
+// CSNQ and the configured routes.
+func apiRoutes(cfg config.APIConfig) []string {
+	codes := []string{"CSNQ"}
+	for code := range cfg.Routes {
+		if code != "CSNQ" {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes[1:])
+	return codes
+}
+
+// Start opens all listeners and begins accepting connections in the background.
+// If any listener fails to open, those already opened are closed again.
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return errors.New("server already started")
+	}
+
+	chain, err := s.buildChain()
+	if err != nil {
+		return err
+	}
+	s.chain = chain
+
+	ctx, cancel := context.WithCancel(ctx)
+	listeners := make([]net.Listener, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		l, err := p.Listen()
+		if err != nil {
+			cancel()
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return fmt.Errorf("failed to listen on %s: %w", p.Address, err)
+		}
+		listeners = append(listeners, l)
+		slog.Info("Listening",
+			"listener", p.Name, "host", l.Addr().String(),
+			"forward", p.Forward, "apiRoutes", p.Routes.APIRoutes)
+	}
+
+	s.cancel = cancel
+	s.listeners = listeners
+
+	// Unblock Accept when the parent context is canceled without Stop
+	context.AfterFunc(ctx, func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	})
+
+	if s.sf != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.sf.Run(ctx)
+		}()
+	}
+
+	for i, l := range listeners {
+		s.wg.Add(1)
+		go func(l net.Listener, p *Profile) {
+			defer s.wg.Done()
+			if p.Gateway != nil {
+				s.serveGateway(ctx, l, p)
+				return
+			}
+			s.accepter(ctx, l, p)
+		}(l, s.profiles[i])
+	}
+
+	return nil
+}
+
+// Register makes a middleware available under name, replacing any built-in one
+// of the same name. The configuration orders middleware by name, so Register
+// must be called before Start.
+func (s *Server) Register(name string, mw middleware.Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middleware[name] = mw
+}
+
+// buildChain resolves the configured middleware names.
+func (s *Server) buildChain() ([]middleware.Middleware, error) {
+	chain := make([]middleware.Middleware, 0, len(s.cfg.Middleware))
+	for _, name := range s.cfg.Middleware {
+		mw, ok := s.middleware[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware %q", name)
+		}
+		chain = append(chain, mw)
+	}
+	return chain, nil
+}
+
+// limitsMiddleware applies the rate limits when they are configured.
+func (s *Server) limitsMiddleware(next middleware.Handler) middleware.Handler {
+	if s.limits == nil {
+		return next
+	}
+	return s.limits.Middleware(next)
+}
+
+// nextSTAN returns a six digit STAN for requests that carry none, cycling from 000001 to 999999.
+func (s *Server) nextSTAN() string {
+	return fmt.Sprintf("%06d", (s.stan.Add(1)-1)%999999+1)
+}
+
+// Addrs returns the addresses of the open listeners, in configuration order.
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, l := range s.listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// Reload applies the settings of cfg that can change at runtime, currently the access lists.
+// Other settings require a new server.
+func (s *Server) Reload(cfg *config.Config) error {
+	acl, err := NewACL(cfg.ACL)
+	if err != nil {
+		return err
+	}
+	s.acl.Store(acl)
+
+	slog.Info("Configuration reloaded", "allow", cfg.ACL.Allow, "deny", cfg.ACL.Deny)
+	return nil
+}
+
+// Stop closes the listeners and all client connections and waits for their handlers to finish.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	slog.Info("Server stopped")
+}
+
+// track registers an accepted connection; it returns false once the server is stopping.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack removes a finished connection.
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
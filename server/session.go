@@ -0,0 +1,178 @@
+package server
+
+import (
+	"cmp"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session holds the activity of a client connection while it is open.
+type Session struct {
+	id         uint64
+	listener   string
+	remoteAddr string
+	connected  time.Time
+
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	mu           sync.Mutex
+	messages     map[string]int64 // messages by route
+	errors       int64
+	lastActivity time.Time
+	inFlight     map[string]int // STANs being processed, with their count
+}
+
+// SessionInfo is a snapshot of a session.
+type SessionInfo struct {
+	ID           uint64           `json:"id"`
+	Listener     string           `json:"listener"`
+	RemoteAddr   string           `json:"remoteAddr"`
+	Connected    time.Time        `json:"connected"`
+	Duration     string           `json:"duration"`
+	BytesIn      int64            `json:"bytesIn"`
+	BytesOut     int64            `json:"bytesOut"`
+	Messages     map[string]int64 `json:"messages"` // by route
+	Errors       int64            `json:"errors"`
+	LastActivity time.Time        `json:"lastActivity"`
+	InFlight     []string         `json:"inFlight"` // STANs being processed
+}
+
+// begin records a message received on a route.
+func (ss *Session) begin(route, stan string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.messages[route]++
+	ss.lastActivity = time.Now()
+	if stan != "" {
+		ss.inFlight[stan]++
+	}
+}
+
+// end records the outcome of a message started with begin.
+func (ss *Session) end(stan string, err error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.lastActivity = time.Now()
+	if err != nil {
+		ss.errors++
+	}
+	if ss.inFlight[stan] > 1 {
+		ss.inFlight[stan]--
+	} else {
+		delete(ss.inFlight, stan)
+	}
+}
+
+// fail records an error outside of message processing, e.g. an invalid frame.
+func (ss *Session) fail() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.errors++
+}
+
+// Info returns a snapshot of the session.
+func (ss *Session) Info() SessionInfo {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return SessionInfo{
+		ID:           ss.id,
+		Listener:     ss.listener,
+		RemoteAddr:   ss.remoteAddr,
+		Connected:    ss.connected,
+		Duration:     time.Since(ss.connected).Round(time.Millisecond).String(),
+		BytesIn:      ss.bytesIn.Load(),
+		BytesOut:     ss.bytesOut.Load(),
+		Messages:     maps.Clone(ss.messages),
+		Errors:       ss.errors,
+		LastActivity: ss.lastActivity,
+		InFlight:     slices.Sorted(maps.Keys(ss.inFlight)),
+	}
+}
+
+// sessionConn counts the bytes exchanged with the client.
+type sessionConn struct {
+	net.Conn
+	session *Session
+}
+
+func (c *sessionConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.session.bytesIn.Add(int64(n))
+	return n, err
+}
+
+func (c *sessionConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.session.bytesOut.Add(int64(n))
+	return n, err
+}
+
+// openSession registers the session of a new client connection and returns the
+// connection counting its bytes.
+func (s *Server) openSession(p *Profile, conn net.Conn) (*Session, net.Conn) {
+	now := time.Now()
+	ss := &Session{
+		id:           s.sessionID.Add(1),
+		listener:     p.Name,
+		remoteAddr:   conn.RemoteAddr().String(),
+		connected:    now,
+		messages:     make(map[string]int64),
+		lastActivity: now,
+		inFlight:     make(map[string]int),
+	}
+
+	s.mu.Lock()
+	s.sessions[ss.id] = ss
+	s.mu.Unlock()
+	return ss, &sessionConn{Conn: conn, session: ss}
+}
+
+// closeSession removes a session and logs its summary.
+func (s *Server) closeSession(ss *Session) {
+	s.mu.Lock()
+	delete(s.sessions, ss.id)
+	s.mu.Unlock()
+
+	info := ss.Info()
+	slog.Info("Session summary",
+		"session", info.ID,
+		"listener", info.Listener,
+		"remoteAddr", info.RemoteAddr,
+		"duration", info.Duration,
+		"bytesIn", info.BytesIn,
+		"bytesOut", info.BytesOut,
+		"messages", info.Messages,
+		"errors", info.Errors,
+		"inFlight", info.InFlight)
+}
+
+// Sessions returns a snapshot of the open client sessions, oldest first.
+func (s *Server) Sessions() []SessionInfo {
+	s.mu.Lock()
+	sessions := slices.Collect(maps.Values(s.sessions))
+	s.mu.Unlock()
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, ss := range sessions {
+		infos = append(infos, ss.Info())
+	}
+	slices.SortFunc(infos, func(a, b SessionInfo) int { return cmp.Compare(a.ID, b.ID) })
+	return infos
+}
+
+// Session returns a snapshot of an open client session.
+func (s *Server) Session(id uint64) (SessionInfo, bool) {
+	s.mu.Lock()
+	ss, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		return SessionInfo{}, false
+	}
+	return ss.Info(), true
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+func TestServerSessions(t *testing.T) {
+	cfg := config.Default()
+	cfg.Forward = startEcho(t)
+	cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+	cfg.Listeners = []config.ListenerConfig{{Name: "atm", Address: "127.0.0.1:0"}}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(srv.Stop)
+
+	conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	const request = "<XML><ProcCode>PURC</ProcCode><STAN>42</STAN></XML>"
+	for range 2 {
+		exchange(t, conn, request)
+	}
+
+	admin := httptest.NewServer(srv.AdminHandler())
+	defer admin.Close()
+
+	var sessions []SessionInfo
+	getJSON(t, admin.URL+"/sessions", http.StatusOK, &sessions)
+	if len(sessions) != 1 {
+		t.Fatalf("GET /sessions = %d sessions, want 1", len(sessions))
+	}
+	got := sessions[0]
+	frameLen := int64(len(*framing.Default.Frame([]byte(request))))
+	if got.Listener != "atm" || got.RemoteAddr != conn.LocalAddr().String() {
+		t.Errorf("session = %+v, want the atm client %s", got, conn.LocalAddr())
+	}
+	if got.BytesIn != 2*frameLen || got.BytesOut != 2*frameLen {
+		t.Errorf("session bytes in/out = %d/%d, want %d/%d", got.BytesIn, got.BytesOut, 2*frameLen, 2*frameLen)
+	}
+	if got.Messages["forward"] != 2 || got.Errors != 0 || len(got.InFlight) != 0 {
+		t.Errorf("session = %+v, want 2 forward messages, no errors and none in flight", got)
+	}
+
+	var one SessionInfo
+	getJSON(t, admin.URL+"/sessions/"+strconv.FormatUint(got.ID, 10), http.StatusOK, &one)
+	if one.ID != got.ID || one.Listener != "atm" {
+		t.Errorf("GET /sessions/%d = %+v, want the session", got.ID, one)
+	}
+	getJSON(t, admin.URL+"/sessions/999", http.StatusNotFound, nil)
+	getJSON(t, admin.URL+"/sessions/x", http.StatusBadRequest, nil)
+
+	// The session ends with the connection
+	conn.Close()
+	waitFor(t, "the session to close", func() bool { return len(srv.Sessions()) == 0 })
+}
+
+// getJSON fetches url, checks the status and decodes the JSON body into v.
+func getJSON(t *testing.T, url string, status int, v any) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != status {
+		t.Fatalf("GET %s status = %d, want %d", url, res.StatusCode, status)
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s decode error = %v", url, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/queue"
+	"github.com/andrei-cloud/netfwd/routing"
+	"github.com/andrei-cloud/netfwd/transform"
+	"github.com/andrei-cloud/netfwd/upstream"
+)
+
+// Store-and-forward counters
+var (
+	storeForwardQueued    = metrics.NewCounter("store_forward_queued")
+	storeForwardDelivered = metrics.NewCounter("store_forward_delivered")
+	storeForwardRetries   = metrics.NewCounter("store_forward_retries")
+	storeForwardDead      = metrics.NewCounter("store_forward_dead")
+)
+
+// StoreForward queues messages that must eventually reach the forward host, such
+// as reversals and advices, and delivers them in the background.
+type StoreForward struct {
+	cfg     config.StoreForwardConfig
+	queue   *queue.Queue
+	profile func(name string) *Profile // listener profiles by name
+	wake    chan struct{}              // signals a newly queued message
+}
+
+// NewStoreForward opens the queue directory and applies the defaults.
+func NewStoreForward(cfg config.StoreForwardConfig, profile func(string) *Profile) (*StoreForward, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("store and forward requires a queue directory")
+	}
+	switch cfg.Ack {
+	case "":
+		cfg.Ack = config.AckImmediate
+	case config.AckImmediate, config.AckOnFailure:
+	default:
+		return nil, fmt.Errorf("unknown store and forward ack rule %q", cfg.Ack)
+	}
+	if cfg.ActCode == "" {
+		cfg.ActCode = "0"
+	}
+	if cfg.Description == "" {
+		cfg.Description = "Accepted for delivery"
+	}
+	if cfg.RetryInterval.Duration <= 0 {
+		cfg.RetryInterval.Duration = 30 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.Timeout.Duration <= 0 {
+		cfg.Timeout.Duration = 30 * time.Second
+	}
+
+	q, err := queue.Open(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return &StoreForward{cfg: cfg, queue: q, profile: profile, wake: make(chan struct{}, 1)}, nil
+}
+
+// Middleware queues the configured forward messages and acknowledges them to the
+// client, either at once or after forwarding them failed. Listeners with an
+// ISO 8583 upstream are not queued.
+func (sf *StoreForward) Middleware(next middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		p := sf.profile(m.Listener)
+		if m.Dest != routing.Forward || p == nil || p.ISO != nil || !sf.matches(m) {
+			return next(ctx, m)
+		}
+
+		if sf.cfg.Ack == config.AckOnFailure {
+			response, err := next(ctx, m)
+			if err == nil && response != nil {
+				return response, nil
+			}
+			slog.Warn("Forwarding failed, queueing message",
+				"listener", m.Listener, "procCode", m.ProcCode, "error", err)
+		}
+
+		body := m.Framer.Body(m.Body)
+		e := &queue.Entry{
+			Listener: m.Listener,
+			ProcCode: m.ProcCode,
+			STAN:     routing.ExtractTag(body, "STAN"),
+			Body:     append([]byte(nil), body...),
+		}
+		if err := sf.queue.Put(e); err != nil {
+			return nil, fmt.Errorf("failed to queue message: %w", err)
+		}
+		storeForwardQueued.Add(1)
+		slog.Info("Message queued for delivery", "listener", m.Listener, "procCode", m.ProcCode, "stan", e.STAN, "id", e.ID)
+
+		select {
+		case sf.wake <- struct{}{}:
+		default:
+		}
+		return m.Framer.Frame(transform.Decline(body, sf.cfg.ActCode, sf.cfg.Description)), nil
+	}
+}
+
+// matches reports whether a message is one of the queued types.
+func (sf *StoreForward) matches(m *middleware.Message) bool {
+	if slices.Contains(sf.cfg.ProcCodes, m.ProcCode) {
+		return true
+	}
+	return len(sf.cfg.MessageTypes) > 0 &&
+		slices.Contains(sf.cfg.MessageTypes, routing.ExtractTag(m.Body, "MessageType"))
+}
+
+// Run delivers the queued messages when they are due until ctx ends.
+func (sf *StoreForward) Run(ctx context.Context) {
+	ticker := time.NewTicker(min(sf.cfg.RetryInterval.Duration, time.Second))
+	defer ticker.Stop()
+
+	for {
+		sf.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-sf.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue attempts the pending messages whose next attempt is due, oldest
+// first. After a failure the remaining messages of the same listener wait for
+// the next round, so an unreachable host is not retried once per message.
+func (sf *StoreForward) deliverDue(ctx context.Context) {
+	entries, err := sf.queue.List(queue.Pending)
+	if err != nil {
+		slog.Error("Failed to read the store and forward queue", "error", err)
+		return
+	}
+
+	now := time.Now()
+	failed := make(map[string]bool)
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if e.NextAttempt.After(now) || failed[e.Listener] {
+			continue
+		}
+
+		actCode, err := sf.deliver(ctx, e)
+		if err == nil {
+			if err := sf.queue.Remove(e.ID); err != nil {
+				slog.Error("Failed to remove delivered message", "id", e.ID, "error", err)
+			}
+			storeForwardDelivered.Add(1)
+			slog.Info("Queued message delivered", "listener", e.Listener, "procCode", e.ProcCode,
+				"stan", e.STAN, "id", e.ID, "attempts", e.Attempts+1, "actCode", actCode)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		failed[e.Listener] = true
+		e.Attempts++
+		e.LastError = err.Error()
+		if e.Attempts >= sf.cfg.MaxAttempts {
+			if err := sf.queue.Bury(e); err != nil {
+				slog.Error("Failed to dead-letter queued message", "id", e.ID, "error", err)
+				continue
+			}
+			storeForwardDead.Add(1)
+			slog.Error("Queued message dead-lettered", "listener", e.Listener, "procCode", e.ProcCode,
+				"stan", e.STAN, "id", e.ID, "attempts", e.Attempts, "error", err)
+			continue
+		}
+		e.NextAttempt = now.Add(sf.cfg.RetryInterval.Duration)
+		if err := sf.queue.Update(e); err != nil {
+			slog.Error("Failed to update queued message", "id", e.ID, "error", err)
+			continue
+		}
+		storeForwardRetries.Add(1)
+		slog.Warn("Queued message delivery failed", "listener", e.Listener, "procCode", e.ProcCode,
+			"stan", e.STAN, "id", e.ID, "attempts", e.Attempts, "error", err)
+	}
+}
+
+// deliver sends a queued message to the forward host of its listener on a new
+// connection and returns the action code of the response. Any response counts
+// as delivered.
+func (sf *StoreForward) deliver(ctx context.Context, e *queue.Entry) (string, error) {
+	p := sf.profile(e.Listener)
+	if p == nil {
+		return "", fmt.Errorf("listener %q is not configured", e.Listener)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sf.cfg.Timeout.Duration)
+	defer cancel()
+
+	conn, _, err := p.dialForward(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	res, err := p.forward(p.Framer.Frame(e.Body), func(msg *[]byte) (*[]byte, error) {
+		return upstream.Forward(conn, p.ForwardFramer, msg)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+	return routing.ExtractTag(p.Framer.Body(*res), "ActCode"), nil
+}
+
+// storeForwardMiddleware queues messages when store and forward is configured.
+func (s *Server) storeForwardMiddleware(next middleware.Handler) middleware.Handler {
+	if s.sf == nil {
+		return next
+	}
+	return s.sf.Middleware(next)
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/queue"
+)
+
+// unusedAddr returns a local address nothing listens on.
+func unusedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// startStoreForward starts a server queueing RVSL messages in a temporary directory.
+func startStoreForward(t *testing.T, forward string, sf config.StoreForwardConfig) (*queue.Queue, net.Conn) {
+	sf.Dir = t.TempDir()
+	sf.ProcCodes = []string{"RVSL"}
+	sf.RetryInterval = config.Duration{Duration: 20 * time.Millisecond}
+
+	cfg := config.Default()
+	cfg.Forward = forward
+	cfg.API = config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}
+	cfg.Listeners = []config.ListenerConfig{{Name: "atm", Address: "127.0.0.1:0"}}
+	cfg.StoreForward = &sf
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(srv.Stop)
+
+	conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return srv.sf.queue, conn
+}
+
+// exchange sends a message body on conn and returns the response body.
+func exchange(t *testing.T, conn net.Conn, body string) string {
+	t.Helper()
+	if _, err := conn.Write(*framing.Default.Frame([]byte(body))); err != nil {
+		t.Fatal(err)
+	}
+	res, err := framing.Read(conn)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	return string(res[framing.DefaultLengthSize:])
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStoreForward(t *testing.T) {
+	const reversal = "<XML><ProcCode>RVSL</ProcCode><STAN>42</STAN></XML>"
+
+	t.Run("immediate ack while the host is down", func(t *testing.T) {
+		forward := unusedAddr(t)
+		q, conn := startStoreForward(t, forward, config.StoreForwardConfig{})
+
+		res := exchange(t, conn, reversal)
+		for _, want := range []string{"<STAN>42</STAN>", "<ActCode>0</ActCode>", "Accepted for delivery"} {
+			if !strings.Contains(res, want) {
+				t.Errorf("ack = %s, want %s", res, want)
+			}
+		}
+		waitFor(t, "a failed attempt", func() bool {
+			pending, _ := q.List(queue.Pending)
+			return len(pending) == 1 && pending[0].Attempts > 0 && pending[0].LastError != ""
+		})
+
+		// Delivered once the host is back
+		_, received := startHost(t, forward, true)
+		select {
+		case msg := <-received:
+			if msg != reversal {
+				t.Errorf("host received %s, want %s", msg, reversal)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("queued message not delivered")
+		}
+		waitFor(t, "an empty queue", func() bool {
+			pending, _ := q.List(queue.Pending)
+			return len(pending) == 0
+		})
+	})
+
+	t.Run("forwarded while the host answers", func(t *testing.T) {
+		forward, received := startHost(t, "127.0.0.1:0", true)
+		q, conn := startStoreForward(t, forward, config.StoreForwardConfig{Ack: config.AckOnFailure})
+
+		if res := exchange(t, conn, reversal); res != "<XML><Reply/></XML>" {
+			t.Errorf("response = %s, want the host response", res)
+		}
+		if msg := <-received; msg != reversal {
+			t.Errorf("host received %s, want %s", msg, reversal)
+		}
+		if pending, _ := q.List(queue.Pending); len(pending) != 0 {
+			t.Errorf("queue holds %d messages, want none", len(pending))
+		}
+	})
+
+	t.Run("dead-lettered after the last attempt", func(t *testing.T) {
+		q, conn := startStoreForward(t, unusedAddr(t), config.StoreForwardConfig{MaxAttempts: 2})
+
+		exchange(t, conn, reversal)
+		waitFor(t, "a dead-lettered message", func() bool {
+			dead, _ := q.List(queue.Dead)
+			return len(dead) == 1 && dead[0].Attempts == 2 && bytes.Equal(dead[0].Body, []byte(reversal))
+		})
+		// Bury writes the dead entry before removing the pending one
+		waitFor(t, "no pending messages", func() bool {
+			pending, _ := q.List(queue.Pending)
+			return len(pending) == 0
+		})
+	})
+}
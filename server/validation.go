@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/routing"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// invalidRequests counts API requests declined by validation
+var invalidRequests = metrics.NewCounter("invalid_requests")
+
+// Validator checks API requests against per ProcCode field rules.
+type Validator struct {
+	cfg   config.ValidationConfig
+	rules map[string][]fieldRule
+}
+
+// fieldRule is a FieldRule with its pattern compiled.
+type fieldRule struct {
+	config.FieldRule
+	pattern *regexp.Regexp
+}
+
+// Violation is a failed validation rule.
+type Violation struct {
+	Field string
+	Rule  string // required, minLength, maxLength, pattern or allowed
+}
+
+// String describes the violation, e.g. "STAN required".
+func (v Violation) String() string {
+	return v.Field + " " + v.Rule
+}
+
+// NewValidator compiles the validation rules.
+func NewValidator(cfg config.ValidationConfig) (*Validator, error) {
+	v := &Validator{cfg: cfg, rules: make(map[string][]fieldRule)}
+	for code, rules := range cfg.Rules {
+		for _, r := range rules {
+			if r.Field == "" {
+				return nil, fmt.Errorf("validation rule for %s has no field", code)
+			}
+			fr := fieldRule{FieldRule: r}
+			if r.Pattern != "" {
+				re, err := regexp.Compile("^(?:" + r.Pattern + ")$")
+				if err != nil {
+					return nil, fmt.Errorf("validation rule for %s %s: %w", code, r.Field, err)
+				}
+				fr.pattern = re
+			}
+			v.rules[code] = append(v.rules[code], fr)
+		}
+	}
+	return v, nil
+}
+
+// Check validates a message of the given ProcCode, returning the first failed rule.
+// Rules other than required are not applied to absent or empty fields.
+func (v *Validator) Check(procCode string, msg []byte) (Violation, bool) {
+	for _, r := range v.rules[procCode] {
+		value := strings.TrimSpace(xmlText(routing.ExtractTag(msg, r.Field)))
+		if value == "" {
+			if r.Required {
+				return Violation{r.Field, "required"}, false
+			}
+			continue
+		}
+
+		n := utf8.RuneCountInString(value)
+		switch {
+		case r.MinLength > 0 && n < r.MinLength:
+			return Violation{r.Field, "minLength"}, false
+		case r.MaxLength > 0 && n > r.MaxLength:
+			return Violation{r.Field, "maxLength"}, false
+		case r.pattern != nil && !r.pattern.MatchString(value):
+			return Violation{r.Field, "pattern"}, false
+		case len(r.Allowed) > 0 && !slices.Contains(r.Allowed, value):
+			return Violation{r.Field, "allowed"}, false
+		}
+	}
+	return Violation{}, true
+}
+
+// xmlText resolves the entity and character references in the raw content of
+// an element. Content that does not parse is returned as is.
+func xmlText(raw string) string {
+	if !strings.ContainsAny(raw, "&<") {
+		return raw
+	}
+	var text string
+	if err := xml.Unmarshal([]byte("<v>"+raw+"</v>"), &text); err != nil {
+		return raw
+	}
+	return text
+}
+
+// Middleware answers API requests failing validation with the decline XML
+// naming the failed rule, so they never reach the API.
+func (v *Validator) Middleware(next middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		if m.Dest != routing.API {
+			return next(ctx, m)
+		}
+
+		violation, ok := v.Check(m.ProcCode, m.Body)
+		if ok {
+			return next(ctx, m)
+		}
+
+		invalidRequests.Add(1)
+		slog.Warn("Request failed validation, declining message",
+			"procCode", m.ProcCode, "rule", violation.String(), "remoteAddr", m.RemoteAddr.String())
+		description := v.cfg.DeclineDescription + ": " + violation.String()
+		return m.Framer.Frame(transform.Decline(m.Body, v.cfg.DeclineCode, description)), nil
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/middleware"
+	"github.com/andrei-cloud/netfwd/routing"
+)
+
+func TestValidatorCheck(t *testing.T) {
+	v, err := NewValidator(config.ValidationConfig{Rules: map[string][]config.FieldRule{
+		"CSNQ": {
+			{Field: "STAN", Required: true, MaxLength: 12, Pattern: `[0-9]+`},
+			{Field: "PName", Required: true, Allowed: []string{"ACCOUNTNUMBER", "CUSTOMERNUMBER"}},
+			{Field: "PValue", Required: true, MinLength: 6},
+			{Field: "DeliveryChannelCtrlID", Allowed: []string{"ATM", "IVR"}},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("NewValidator() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		msg    string
+		want   string
+		wantOK bool
+	}{
+		{"valid", "CSNQ", `<XML><STAN>1</STAN><PName>ACCOUNTNUMBER</PName><PValue>157336</PValue></XML>`, "", true},
+		{"missing STAN", "CSNQ", `<XML><PName>ACCOUNTNUMBER</PName><PValue>157336</PValue></XML>`, "STAN required", false},
+		{"empty PValue", "CSNQ", `<XML><STAN>1</STAN><PName>ACCOUNTNUMBER</PName><PValue> </PValue></XML>`, "PValue required", false},
+		{"STAN too long", "CSNQ", `<XML><STAN>1234567890123</STAN></XML>`, "STAN maxLength", false},
+		{"STAN not numeric", "CSNQ", `<XML><STAN>12a</STAN></XML>`, "STAN pattern", false},
+		{"PName not allowed", "CSNQ", `<XML><STAN>1</STAN><PName>EMAIL</PName></XML>`, "PName allowed", false},
+		{"PValue too short", "CSNQ", `<XML><STAN>1</STAN><PName>ACCOUNTNUMBER</PName><PValue>157</PValue></XML>`, "PValue minLength", false},
+		{"channel not allowed", "CSNQ",
+			`<XML><STAN>1</STAN><PName>ACCOUNTNUMBER</PName><PValue>157336</PValue><DeliveryChannelCtrlID>WEB</DeliveryChannelCtrlID></XML>`,
+			"DeliveryChannelCtrlID allowed", false},
+		{"escaped STAN", "CSNQ", `<XML><STAN>&#49;2</STAN><PName>ACCOUNTNUMBER</PName><PValue>157336</PValue></XML>`, "", true},
+		{"escaped PValue too short", "CSNQ",
+			`<XML><STAN>1</STAN><PName>ACCOUNTNUMBER</PName><PValue>&amp;&amp;&amp;</PValue></XML>`, "PValue minLength", false},
+		{"other route", "ACNQ", `<XML></XML>`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := v.Check(tt.code, []byte(tt.msg))
+			if ok != tt.wantOK {
+				t.Fatalf("Check() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok && got.String() != tt.want {
+				t.Errorf("Check() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewValidatorErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []config.FieldRule
+	}{
+		{"missing field", []config.FieldRule{{Required: true}}},
+		{"invalid pattern", []config.FieldRule{{Field: "STAN", Pattern: "["}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewValidator(config.ValidationConfig{Rules: map[string][]config.FieldRule{"CSNQ": tt.rules}})
+			if err == nil {
+				t.Error("NewValidator() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestValidatorMiddleware(t *testing.T) {
+	v, err := NewValidator(config.ValidationConfig{
+		Rules:              map[string][]config.FieldRule{"CSNQ": {{Field: "PValue", Required: true}}},
+		DeclineCode:        "30",
+		DeclineDescription: "Invalid request",
+	})
+	if err != nil {
+		t.Fatalf("NewValidator() error = %v", err)
+	}
+
+	called := false
+	h := v.Middleware(func(ctx context.Context, m *middleware.Message) (*[]byte, error) {
+		called = true
+		return &m.Body, nil
+	})
+
+	m := &middleware.Message{
+		Body:       *framing.Default.Frame([]byte(`<XML><ProcCode>CSNQ</ProcCode><STAN>5</STAN></XML>`)),
+		ProcCode:   "CSNQ",
+		Dest:       routing.API,
+		RemoteAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Framer:     framing.Default,
+	}
+	res, err := h(context.Background(), m)
+	if err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+	if called {
+		t.Error("invalid request reached the API")
+	}
+	for _, want := range []string{"<ActCode>30</ActCode>", "<ActDescription>Invalid request: PValue required</ActDescription>", "<STAN>5</STAN>"} {
+		if !bytes.Contains(*res, []byte(want)) {
+			t.Errorf("response = %s, want %s", *res, want)
+		}
+	}
+
+	// Forwarded messages are not validated
+	m.Dest = routing.Forward
+	if _, err := h(context.Background(), m); err != nil || !called {
+		t.Errorf("forward message was not passed on, error = %v", err)
+	}
+}
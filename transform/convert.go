@@ -0,0 +1,320 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Generic conversion convention between XML messages and JSON objects:
+//   - the root element is the JSON object and is named XML on the way back
+//   - child elements become keys, in document order
+//   - an element holding only text becomes a string
+//   - repeated sibling elements become an array
+//   - attributes become keys prefixed with AttrPrefix
+//   - the text of an element with attributes or children becomes TextKey
+const (
+	AttrPrefix = "@"
+	TextKey    = "#text"
+)
+
+// element is a parsed XML element.
+type element struct {
+	name     string
+	attrs    []xml.Attr
+	children []*element
+	text     strings.Builder
+}
+
+// XMLToJSON converts an XML message to a JSON object following the generic convention.
+func XMLToJSON(data []byte) ([]byte, error) {
+	root, err := parseElement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeObject(&buf, root)
+	return buf.Bytes(), nil
+}
+
+// parseElement parses an XML document into its root element.
+func parseElement(data []byte) (*element, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var root *element
+	var stack []*element
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML message: %w", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			e := &element{name: tok.Name.Local, attrs: tok.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root != nil {
+				return nil, errors.New("invalid XML message: expected a single root element")
+			} else {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(tok)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if root == nil || len(stack) != 0 {
+		return nil, errors.New("invalid XML message: expected a single root element")
+	}
+	return root, nil
+}
+
+// writeValue writes an element as a string when it holds only text, otherwise as an object.
+func writeValue(buf *bytes.Buffer, e *element) {
+	if len(e.attrs) == 0 && len(e.children) == 0 {
+		writeString(buf, strings.TrimSpace(e.text.String()))
+		return
+	}
+	writeObject(buf, e)
+}
+
+// writeObject writes the attributes, text and children of an element as a JSON object.
+func writeObject(buf *bytes.Buffer, e *element) {
+	buf.WriteByte('{')
+	n := 0
+	field := func(key string) {
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		writeString(buf, key)
+		buf.WriteByte(':')
+		n++
+	}
+
+	for _, a := range e.attrs {
+		field(AttrPrefix + a.Name.Local)
+		writeString(buf, a.Value)
+	}
+	if text := strings.TrimSpace(e.text.String()); text != "" {
+		field(TextKey)
+		writeString(buf, text)
+	}
+
+	// Group repeated children by name, in order of first appearance
+	var names []string
+	groups := make(map[string][]*element)
+	for _, c := range e.children {
+		if _, ok := groups[c.name]; !ok {
+			names = append(names, c.name)
+		}
+		groups[c.name] = append(groups[c.name], c)
+	}
+	for _, name := range names {
+		field(name)
+		group := groups[name]
+		if len(group) == 1 {
+			writeValue(buf, group[0])
+			continue
+		}
+		buf.WriteByte('[')
+		for i, c := range group {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeValue(buf, c)
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+}
+
+// writeString writes a JSON string without escaping HTML characters.
+func writeString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // drop the newline added by Encode
+}
+
+// object is a JSON object keeping its key order.
+type object struct {
+	keys   []string
+	values []any
+}
+
+// JSONToXML converts a JSON object to an XML message following the generic convention.
+// Numbers and booleans become their text and null an empty element.
+func JSONToXML(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON message: %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid JSON message: unexpected data after the object")
+	}
+	obj, ok := v.(*object)
+	if !ok {
+		return nil, errors.New("JSON message must be an object")
+	}
+
+	var buf bytes.Buffer
+	if err := writeElement(&buf, "XML", obj); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeValue decodes the next JSON value, keeping the key order of objects.
+func decodeValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := &object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, key.(string))
+			obj.values = append(obj.values, v)
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		var arr []any
+		for dec.More() {
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// writeElement writes a JSON value as an XML element.
+func writeElement(buf *bytes.Buffer, name string, v any) error {
+	if !validTag(name) {
+		return fmt.Errorf("key %q is not a valid XML tag", name)
+	}
+
+	obj, ok := v.(*object)
+	if !ok {
+		text, err := scalarText(name, v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("<" + name + ">")
+		xml.EscapeText(buf, []byte(text))
+		buf.WriteString("</" + name + ">")
+		return nil
+	}
+
+	// Attributes go in the start tag whatever their position in the object
+	buf.WriteString("<" + name)
+	for i, key := range obj.keys {
+		attr, ok := strings.CutPrefix(key, AttrPrefix)
+		if !ok {
+			continue
+		}
+		if !validTag(attr) {
+			return fmt.Errorf("key %q is not a valid XML attribute", key)
+		}
+		text, err := scalarText(key, obj.values[i])
+		if err != nil {
+			return err
+		}
+		buf.WriteString(" " + attr + `="`)
+		xml.EscapeText(buf, []byte(text))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for i, key := range obj.keys {
+		switch v := obj.values[i]; {
+		case strings.HasPrefix(key, AttrPrefix):
+		case key == TextKey:
+			text, err := scalarText(key, v)
+			if err != nil {
+				return err
+			}
+			xml.EscapeText(buf, []byte(text))
+		default:
+			items, isArray := v.([]any)
+			if !isArray {
+				items = []any{v}
+			}
+			for _, item := range items {
+				if _, nested := item.([]any); nested {
+					return fmt.Errorf("key %q: nested arrays are not supported", key)
+				}
+				if err := writeElement(buf, key, item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+// scalarText returns the text of a JSON string, number, boolean or null.
+func scalarText(key string, v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("key %q must hold a string, number, boolean or null", key)
+}
+
+// validTag reports whether s can be used as an XML element name.
+func validTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package transform
+
+import (
+	"testing"
+)
+
+func TestJSONToXML(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{"ordered keys", `{"ProcCode":"CRNQ","STAN":"1","PValue":"157336"}`,
+			`<XML><ProcCode>CRNQ</ProcCode><STAN>1</STAN><PValue>157336</PValue></XML>`, false},
+		{"numbers and booleans", `{"Amount":12.50,"Flag":true,"Empty":null}`,
+			`<XML><Amount>12.50</Amount><Flag>true</Flag><Empty></Empty></XML>`, false},
+		{"escaped text", `{"Name":"A&B <C>"}`, `<XML><Name>A&amp;B &lt;C&gt;</Name></XML>`, false},
+		{"nested object", `{"Customer":{"Name":"A","Address":{"City":"Dubai"}}}`,
+			`<XML><Customer><Name>A</Name><Address><City>Dubai</City></Address></Customer></XML>`, false},
+		{"array", `{"Account":["1","2"]}`, `<XML><Account>1</Account><Account>2</Account></XML>`, false},
+		{"attributes and text", `{"Amount":{"#text":"100","@currency":"AED"},"@version":"2"}`,
+			`<XML version="2"><Amount currency="AED">100</Amount></XML>`, false},
+		{"not an object", `["a"]`, "", true},
+		{"nested array", `{"A":[["1"]]}`, "", true},
+		{"object attribute", `{"@a":{"b":"1"}}`, "", true},
+		{"invalid tag", `{"1A":"x"}`, "", true},
+		{"truncated", `{"A":"1"`, "", true},
+		{"trailing data", `{"A":"1"} {}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSONToXML([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("JSONToXML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("JSONToXML() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXMLToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{"document order", `<XML><STAN>1</STAN><ActCode>0</ActCode><Name> A&amp;B </Name></XML>`,
+			`{"STAN":"1","ActCode":"0","Name":"A&B"}`, false},
+		{"empty message", `<XML></XML>`, `{}`, false},
+		{"nested elements", "<XML>\n  <Customer>\n    <Name>A</Name>\n    <Address><City>Dubai</City></Address>\n  </Customer>\n</XML>",
+			`{"Customer":{"Name":"A","Address":{"City":"Dubai"}}}`, false},
+		{"repeated elements", `<XML><Account>1</Account><Name>A</Name><Account>2</Account></XML>`,
+			`{"Account":["1","2"],"Name":"A"}`, false},
+		{"attributes", `<XML version="2"><Amount currency="AED">100</Amount></XML>`,
+			`{"@version":"2","Amount":{"@currency":"AED","#text":"100"}}`, false},
+		{"no root", ``, "", true},
+		{"two roots", `<A></A><B></B>`, "", true},
+		{"unclosed", `<XML><STAN>1</STAN>`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := XMLToJSON([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("XMLToJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("XMLToJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	msg := `<XML version="2"><STAN>1</STAN><Account type="CA">1</Account><Account type="SA">2</Account>` +
+		`<Customer><Name>A</Name></Customer></XML>`
+
+	data, err := XMLToJSON([]byte(msg))
+	if err != nil {
+		t.Fatalf("XMLToJSON() error = %v", err)
+	}
+	back, err := JSONToXML(data)
+	if err != nil {
+		t.Fatalf("JSONToXML() error = %v", err)
+	}
+	if string(back) != msg {
+		t.Errorf("round trip = %s, want %s", back, msg)
+	}
+}
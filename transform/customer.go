@@ -0,0 +1,103 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDateLayout is the layout of dates in response records, e.g. 20251231.
+const DefaultDateLayout = "20060102"
+
+// dateLayouts are the date formats accepted from the API, tried in order.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02/01/2006",
+	"20060102",
+}
+
+// Date is a date of the customer API. It accepts the formats in dateLayouts
+// and .NET style /Date(milliseconds)/ values; other values are kept verbatim.
+type Date struct {
+	Time time.Time // zero when the value is empty or unparseable
+	Raw  string    // the value as received
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting a string or null.
+func (d *Date) UnmarshalJSON(b []byte) error {
+	*d = Date{}
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if err := json.Unmarshal(b, &d.Raw); err != nil {
+		return fmt.Errorf("invalid date %s: %w", b, err)
+	}
+	d.Time, _ = parseDate(strings.TrimSpace(d.Raw))
+	return nil
+}
+
+// Format returns the date in the given layout, or the received value when it
+// could not be parsed.
+func (d Date) Format(layout string) string {
+	if d.Time.IsZero() {
+		return d.Raw
+	}
+	return d.Time.Format(layout)
+}
+
+// parseDate parses an API date value.
+func parseDate(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if strings.HasPrefix(s, "/Date(") && strings.HasSuffix(s, ")/") {
+		ms := s[len("/Date(") : len(s)-len(")/")]
+		// Drop a timezone offset such as +0300; the milliseconds are UTC
+		if i := strings.LastIndexAny(ms, "+-"); i > 0 {
+			ms = ms[:i]
+		}
+		n, err := strconv.ParseInt(ms, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.UnixMilli(n).UTC(), true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// CRNumber is a company registration number, sent by the API as either a
+// string or a number.
+type CRNumber string
+
+// UnmarshalJSON implements json.Unmarshaler, accepting a string, an integer or
+// null. Any other value leaves the number empty rather than failing the whole
+// response.
+func (c *CRNumber) UnmarshalJSON(b []byte) error {
+	*c = ""
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err == nil {
+			*c = CRNumber(strings.TrimSpace(s))
+		}
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return nil
+	}
+	if _, err := n.Int64(); err == nil {
+		*c = CRNumber(n.String())
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestConvertGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "customers", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden inputs in testdata/customers")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".json")
+		t.Run(name, func(t *testing.T) {
+			res, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := DefaultResults().Convert(res)
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+
+			golden := strings.TrimSuffix(input, ".json") + ".xml"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Convert() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		layout string
+		want   string
+	}{
+		{"null", `null`, DefaultDateLayout, ""},
+		{"empty", `""`, DefaultDateLayout, ""},
+		{"date", `"2027-03-31"`, DefaultDateLayout, "20270331"},
+		{"datetime", `"2027-03-31T10:20:30"`, DefaultDateLayout, "20270331"},
+		{"RFC3339", `"1990-02-28T00:00:00+03:00"`, DefaultDateLayout, "19900228"},
+		{"day first", `"15/08/2029"`, DefaultDateLayout, "20290815"},
+		{"milliseconds", `"/Date(1767139200000)/"`, DefaultDateLayout, "20251231"},
+		{"milliseconds with offset", `"/Date(1767139200000+0300)/"`, DefaultDateLayout, "20251231"},
+		{"layout", `"2027-03-31"`, "02/01/2006", "31/03/2027"},
+		{"unparseable", `"unknown"`, DefaultDateLayout, "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Date
+			if err := json.Unmarshal([]byte(tt.value), &d); err != nil {
+				t.Fatalf("UnmarshalJSON() error = %v", err)
+			}
+			if got := d.Format(tt.layout); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var d Date
+	if err := json.Unmarshal([]byte(`12`), &d); err == nil {
+		t.Error("UnmarshalJSON() of a number succeeded, want error")
+	}
+	if err := json.Unmarshal([]byte(`"2027-03-31"`), &d); err != nil || !d.Time.Equal(time.Date(2027, 3, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("UnmarshalJSON() Time = %v, want 2027-03-31", d.Time)
+	}
+}
+
+func TestCRNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    CRNumber
+		wantErr bool
+	}{
+		{"null", `null`, "", false},
+		{"string", `"CR-9981"`, "CR-9981", false},
+		{"padded string", `" 45871 "`, "45871", false},
+		{"number", `45871`, "45871", false},
+		{"large number", `9007199254740993`, "9007199254740993", false},
+		{"fraction", `45871.5`, "", false},
+		{"exponent", `4.5e3`, "", false},
+		{"bool", `true`, "", false},
+		{"object", `{"no":45871}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got CRNumber
+			err := json.Unmarshal([]byte(tt.value), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("UnmarshalJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertCustomerFlags(t *testing.T) {
+	res, err := os.ReadFile(filepath.Join("testdata", "customers", "full.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := DefaultResults()
+	results.CustomerFlags = true
+	got, _, err := results.Convert(res)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	for _, want := range []string{
+		`<CustTypeFlag>I</CustTypeFlag><GUID>0b1e5c1a-41d2-4c77-9a57-3e5b2f6d7a10</GUID><Blacklisted>N</Blacklisted><NationalityWithdrawn>N</NationalityWithdrawn></Record>`,
+		`<CustTypeFlag></CustTypeFlag><GUID></GUID><Blacklisted>Y</Blacklisted><NationalityWithdrawn>Y</NationalityWithdrawn></Record>`,
+	} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("Convert() = %s, want it to contain %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package transform
+
+import "strings"
+
+// Mask renders raw message bytes for logging without exposing card or account
+// numbers: digits become '*' and non-printable bytes '.'. Markup and letters
+// are kept so the bytes can still be recognized.
+func Mask(b []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(b))
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			sb.WriteByte('*')
+		case c < ' ' || c > '~':
+			sb.WriteByte('.')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
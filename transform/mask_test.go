@@ -0,0 +1,9 @@
+package transform
+
+import "testing"
+
+func TestMask(t *testing.T) {
+	if got, want := Mask([]byte("\x02<PAN>4111 1111</PAN>\xff")), ".<PAN>**** ****</PAN>."; got != want {
+		t.Errorf("Mask() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+// Package transform converts messages between the XML channel format
+// and the JSON customer API.
+package transform
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RequestXML represents the structure of incoming XML messages
+type RequestXML struct {
+	XMLName        xml.Name `xml:"XML"`
+	Text           string   `xml:",chardata"`
+	MessageType    string   `xml:"MessageType"`
+	ProcCode       string   `xml:"ProcCode"`
+	RefNum         string   `xml:"REFNUM"`
+	Stan           string   `xml:"STAN"`
+	RequestTime    string   `xml:"LocalTxnDtTime"`
+	ChanelID       string   `xml:"DeliveryChannelCtrlID"`
+	ParameterName  string   `xml:"PName"`
+	ParameterValue string   `xml:"PValue"`
+	PageNo         string   `xml:"PageNo"` // requested page when paging is enabled
+}
+
+// RequestJSON represents the structure of outgoing JSON API requests
+type RequestJSON struct {
+	Info           RequestInfo `json:"RequestInfo"`
+	ParameterName  string      `json:"searchparametername"`
+	ParameterValue string      `json:"searchparametervalue"`
+	PageNumber     int         `json:"pageNumber,omitempty"`
+	PageSize       int         `json:"pageSize,omitempty"`
+}
+
+// Page selects a page of customer records. A zero Size disables paging.
+type Page struct {
+	Number int // 1-based
+	Size   int
+}
+
+// RequestInfo contains common request metadata
+type RequestInfo struct {
+	Stan        string `json:"requestId"`
+	UserID      string `json:"userId,omitempty"`
+	BaseNumber  string `json:"basenumber"`
+	ChanelID    string `json:"chanelId"`
+	RequestTime string `json:"requestTime"`
+}
+
+// Field returns the value of a request field by its XML tag name.
+func (r *RequestXML) Field(name string) string {
+	switch name {
+	case "MessageType":
+		return r.MessageType
+	case "ProcCode":
+		return r.ProcCode
+	case "REFNUM":
+		return r.RefNum
+	case "STAN":
+		return r.Stan
+	case "LocalTxnDtTime":
+		return r.RequestTime
+	case "DeliveryChannelCtrlID":
+		return r.ChanelID
+	case "PName":
+		return r.ParameterName
+	case "PValue":
+		return r.ParameterValue
+	case "PageNo":
+		return r.PageNo
+	}
+	return ""
+}
+
+// ParseRequest parses an XML request message.
+// A leading length prefix, if present, is ignored by the XML decoder.
+func ParseRequest(req []byte) (*RequestXML, error) {
+	xmlReq := &RequestXML{}
+	if err := xml.Unmarshal(req, xmlReq); err != nil {
+		return nil, fmt.Errorf("failed to parse XML request: %w", err)
+	}
+	return xmlReq, nil
+}
+
+// maxPage bounds requested page numbers so page offsets cannot overflow.
+const maxPage = 99999
+
+// Page returns the page of records requested with the given page size.
+// A missing or invalid PageNo selects the first page.
+func (r *RequestXML) Page(size int) Page {
+	if size <= 0 {
+		return Page{}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(r.PageNo))
+	if err != nil || n < 1 {
+		n = 1
+	}
+	return Page{Number: min(n, maxPage), Size: size}
+}
+
+// JSON transforms a parsed XML request to a JSON API request
+func (r *RequestXML) JSON() ([]byte, error) {
+	return r.PageJSON(Page{})
+}
+
+// PageJSON transforms a parsed XML request to a JSON API request for a page of records.
+func (r *RequestXML) PageJSON(p Page) ([]byte, error) {
+	jsonReq := &RequestJSON{
+		Info: RequestInfo{
+			Stan:        r.Stan,
+			UserID:      r.RefNum,
+			BaseNumber:  r.ParameterValue,
+			ChanelID:    r.ChanelID,
+			RequestTime: r.RequestTime,
+		},
+		ParameterName:  "Baseno",
+		ParameterValue: r.ParameterValue,
+		PageNumber:     p.Number,
+		PageSize:       p.Size,
+	}
+
+	// Serialize to JSON
+	result, err := json.Marshal(jsonReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize JSON request: %w", err)
+	}
+
+	return result, nil
+}
+
+// RequestX2J transforms an XML message to a JSON API request
+func RequestX2J(req []byte) ([]byte, error) {
+	xmlReq, err := ParseRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return xmlReq.JSON()
+}
@@ -0,0 +1,386 @@
+package transform
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/netfwd/routing"
+)
+
+// ResponseXML represents the structure of outgoing XML responses
+type ResponseXML struct {
+	XMLName        xml.Name      `xml:"XML"`
+	MessageType    string        `xml:"MessageType"`
+	ProcCode       string        `xml:"ProcCode"`
+	Stan           string        `xml:"STAN"`
+	RequestTime    string        `xml:"LocalTxnDtTime"`
+	ChanelID       string        `xml:"DeliveryChannelCtrlID"`
+	ParameterName  string        `xml:"PName"`
+	ParameterValue string        `xml:"PValue"`
+	ActCode        string        `xml:"ActCode"`
+	ActDescription string        `xml:"ActDescription"`
+	TotalnoofTrans int           `xml:"TotalnoofTrans"`
+	PageNo         int           `xml:"PageNo,omitempty"`
+	MoreRecords    string        `xml:"MoreRecords,omitempty"` // Y when further pages follow
+	Customers      CustomersList `xml:"Customers"`
+	RefNum         string        `xml:"REFNUM"`
+}
+
+// CustomersList represents a collection of customer records
+type CustomersList struct {
+	Records []Record `xml:"Record"`
+}
+
+// Record represents a customer record in the XML response
+type Record struct {
+	Name                   string `xml:"Name"`
+	FirstName              string `xml:"FirstName"`
+	MiddleName             string `xml:"MiddleName"`
+	LastName               string `xml:"LastName"`
+	BaseNumber             string `xml:"BaseNumber"`
+	Nationality            string `xml:"Nationality"`
+	PoBox                  string `xml:"PoBox"`
+	Address                string `xml:"Address"`
+	City                   string `xml:"City"`
+	Country                string `xml:"Country"`
+	Email                  string `xml:"Email"`
+	CardOnlyCustomer       string `xml:"CardOnlyCustomer"`
+	SMSMobile              string `xml:"SMSMobile"`
+	SMSLang                string `xml:"SMSLang"`
+	SMSNationalID          string `xml:"SMSNationalID"`
+	SMSPassportNo          string `xml:"SMSPassportNo"`
+	SegmentCode            string `xml:"SegmentCode"`
+	SegmentDesc            string `xml:"SegmentDesc"`
+	QID                    string `xml:"QID"`
+	QIDExpiryDate          string `xml:"QIDExpiryDate"`
+	PassportNo             string `xml:"PassportNo"`
+	PassportExpiryDate     string `xml:"PassportExpiryDate"`
+	CompanyRegNo           string `xml:"CompanyRegNo"`
+	CompanyRegNoExpiryDate string `xml:"CompanyRegNoExpiryDate"`
+	LOB                    string `xml:"LOB"`
+	DOB                    string `xml:"DOB"`
+	CustTypeFlag           string `xml:"CustTypeFlag"`
+	*RecordFlags                  // only when the customer flags are enabled
+}
+
+// RecordFlags are the customer flags appended to a record when enabled. They
+// are not part of the base record schema.
+type RecordFlags struct {
+	GUID                 string `xml:"GUID"`
+	Blacklisted          string `xml:"Blacklisted"`          // Y or N
+	NationalityWithdrawn string `xml:"NationalityWithdrawn"` // Y or N
+}
+
+// ResponseJSON represents the structure of incoming JSON API responses
+type ResponseJSON struct {
+	Info      RequestInfo `json:"RequestInfo"`
+	Customers []Details   `json:"CustomerDetails"`
+	Message   string      `json:"message"`
+	Total     int         `json:"TotalRecords"` // set by an API that pages its results
+}
+
+// Details represents a customer record in the JSON response
+type Details struct {
+	Qid                      string   `json:"QID"`
+	QidExpiryDate            Date     `json:"QIDEXPIRYDATE"`
+	Baseno                   string   `json:"BASENO"`
+	Crno                     CRNumber `json:"CRNO"`
+	CrnoExpiryDate           Date     `json:"CRNOEXPIRYDATE"`
+	Passportno               string   `json:"PASSPORTNO"`
+	PassportExpiryDate       Date     `json:"PASSPORTEXPIRYDATE"`
+	NationalID               string   `json:"NATIONALID"`
+	Mobileno                 string   `json:"MOBILENO"`
+	SMSLang                  string   `json:"SMSLANG"`
+	Emailid                  string   `json:"EMAILID"`
+	GUID                     string   `json:"GUID"`
+	FirstName                string   `json:"FirstName"`
+	MiddleName               string   `json:"MiddleName"`
+	LastName                 string   `json:"LastName"`
+	Nationality              string   `json:"NATIONALITY"`
+	DOB                      Date     `json:"DOB"`
+	PoBox                    string   `json:"POBOX"`
+	Address                  string   `json:"ADDRESS"`
+	City                     string   `json:"CITY"`
+	Country                  string   `json:"COUNTRY"`
+	SegmentCode              string   `json:"SEGMENTCODE"`
+	SegmentDesc              string   `json:"SEGMENTDESC"`
+	LOB                      string   `json:"LOB"`
+	CustTypeFlag             string   `json:"CUSTTYPEFLAG"`
+	CardOnlyCustomer         *bool    `json:"CARDONLYCUSTOMER"`
+	IsBlacklisted            bool     `json:"IsBlacklisted"`
+	IsQANationalityWithdrawn bool     `json:"IsQANationalityWithdrawn"`
+}
+
+// Record converts the customer details to an XML record, formatting dates with layout.
+func (d Details) Record(layout string) Record {
+	return Record{
+		Name:                   joinNonEmpty(d.FirstName, d.MiddleName, d.LastName),
+		FirstName:              d.FirstName,
+		MiddleName:             d.MiddleName,
+		LastName:               d.LastName,
+		BaseNumber:             d.Baseno,
+		Nationality:            d.Nationality,
+		PoBox:                  d.PoBox,
+		Address:                d.Address,
+		City:                   d.City,
+		Country:                d.Country,
+		Email:                  d.Emailid,
+		CardOnlyCustomer:       optionalYesNo(d.CardOnlyCustomer),
+		SMSMobile:              d.Mobileno,
+		SMSLang:                d.SMSLang,
+		SMSNationalID:          d.NationalID,
+		SegmentCode:            d.SegmentCode,
+		SegmentDesc:            d.SegmentDesc,
+		QID:                    d.Qid,
+		QIDExpiryDate:          d.QidExpiryDate.Format(layout),
+		PassportNo:             d.Passportno,
+		PassportExpiryDate:     d.PassportExpiryDate.Format(layout),
+		CompanyRegNo:           string(d.Crno),
+		CompanyRegNoExpiryDate: d.CrnoExpiryDate.Format(layout),
+		LOB:                    d.LOB,
+		DOB:                    d.DOB.Format(layout),
+		CustTypeFlag:           d.CustTypeFlag,
+	}
+}
+
+// Flags returns the customer flags of the details.
+func (d Details) Flags() *RecordFlags {
+	return &RecordFlags{
+		GUID:                 d.GUID,
+		Blacklisted:          yesNo(d.IsBlacklisted),
+		NationalityWithdrawn: yesNo(d.IsQANationalityWithdrawn),
+	}
+}
+
+// joinNonEmpty joins the non-empty parts with spaces.
+func joinNonEmpty(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+// yesNo formats a flag as Y or N.
+func yesNo(b bool) string {
+	if b {
+		return "Y"
+	}
+	return "N"
+}
+
+// optionalYesNo formats a flag the API may omit as Y or N, or empty when absent.
+func optionalYesNo(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return yesNo(*b)
+}
+
+// ResponseJ2X transforms a JSON API response to an XML message
+func ResponseJ2X(res []byte) ([]byte, error) {
+	result, _, err := ConvertResponse(res)
+	return result, err
+}
+
+// ConvertResponse transforms a JSON API response and also reports the number of customers found.
+func ConvertResponse(res []byte) ([]byte, int, error) {
+	return DefaultResults().Convert(res)
+}
+
+// Convert transforms a JSON API response, setting the action code from the result
+// mapping, and also reports the number of customers found.
+func (r Results) Convert(res []byte) ([]byte, int, error) {
+	return r.ConvertPage(res, Page{})
+}
+
+// ConvertPage transforms a JSON API response like Convert, keeping only the
+// records of page p. A response carrying TotalRecords is taken to be paged by
+// the API already; otherwise the page is cut from the full customer list.
+// The reported count is the total across all pages.
+func (r Results) ConvertPage(res []byte, p Page) ([]byte, int, error) {
+	// Parse JSON response
+	jsonRes := &ResponseJSON{}
+	if err := json.Unmarshal(res, jsonRes); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	total := len(jsonRes.Customers)
+	if jsonRes.Total > 0 {
+		total = jsonRes.Total
+	}
+
+	// Transform to XML format
+	xmlRes := &ResponseXML{
+		MessageType:    "1",
+		ProcCode:       "CSNQ",
+		Stan:           jsonRes.Info.Stan,
+		RequestTime:    jsonRes.Info.RequestTime,
+		ChanelID:       cmp.Or(jsonRes.Info.ChanelID, defaultChannel),
+		ParameterName:  "ACCOUNTNUMBER",
+		ParameterValue: jsonRes.Info.BaseNumber,
+		TotalnoofTrans: total,
+		RefNum:         jsonRes.Info.UserID,
+	}
+
+	customers := jsonRes.Customers
+	if p.Size > 0 {
+		if jsonRes.Total == 0 {
+			start := min((p.Number-1)*p.Size, len(customers))
+			customers = customers[start:min(start+p.Size, len(customers))]
+		}
+		xmlRes.PageNo = p.Number
+		xmlRes.MoreRecords = yesNo(p.Number*p.Size < total)
+	}
+
+	// Transform customer records
+	layout := r.DateLayout
+	if layout == "" {
+		layout = DefaultDateLayout
+	}
+	records := make([]Record, 0, len(customers))
+	for _, c := range customers {
+		record := c.Record(layout)
+		if r.CustomerFlags {
+			record.RecordFlags = c.Flags()
+		}
+		records = append(records, record)
+	}
+	xmlRes.Customers.Records = records
+
+	result := r.classify(jsonRes, total)
+	xmlRes.ActCode, xmlRes.ActDescription = result.Code, result.Description
+
+	// Serialize to XML
+	out, err := xml.Marshal(xmlRes)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to serialize XML response: %w", err)
+	}
+
+	return out, total, nil
+}
+
+// RewriteTags replaces the text of the given XML tags in msg, leaving the rest untouched.
+// Tags that are absent from msg are skipped.
+func RewriteTags(msg []byte, values map[string]string) []byte {
+	out := msg
+	for tag, value := range values {
+		open := []byte("<" + tag + ">")
+		closing := []byte("</" + tag + ">")
+
+		start := bytes.Index(out, open)
+		if start < 0 {
+			continue
+		}
+		start += len(open)
+		end := bytes.Index(out[start:], closing)
+		if end < 0 {
+			continue
+		}
+
+		var escaped bytes.Buffer
+		_ = xml.EscapeText(&escaped, []byte(value))
+
+		rewritten := make([]byte, 0, len(out)-end+escaped.Len())
+		rewritten = append(rewritten, out[:start]...)
+		rewritten = append(rewritten, escaped.Bytes()...)
+		rewritten = append(rewritten, out[start+end:]...)
+		out = rewritten
+	}
+	return out
+}
+
+// defaultChannel is the DeliveryChannelCtrlID answered to requests without one
+const defaultChannel = "ATM"
+
+// IdentityTags returns the per-request fields that must be echoed back in a shared response.
+func IdentityTags(req *RequestXML) map[string]string {
+	return map[string]string{
+		"STAN":                  req.Stan,
+		"REFNUM":                req.RefNum,
+		"LocalTxnDtTime":        req.RequestTime,
+		"DeliveryChannelCtrlID": cmp.Or(req.ChanelID, defaultChannel),
+	}
+}
+
+// Decline builds an XML response to req carrying the given action code,
+// used when a message is answered locally instead of being processed.
+func Decline(req []byte, code, description string) []byte {
+	// Echo whatever identifiers can be parsed; an unparseable request, such as the
+	// start of a truncated message, still gets an answer with the tags found in it
+	xmlReq, err := ParseRequest(req)
+	if err != nil {
+		xmlReq = scanRequest(req)
+	}
+
+	xmlRes := &ResponseXML{
+		MessageType:    "1",
+		ProcCode:       xmlReq.ProcCode,
+		Stan:           xmlReq.Stan,
+		RequestTime:    xmlReq.RequestTime,
+		ChanelID:       xmlReq.ChanelID,
+		ParameterName:  xmlReq.ParameterName,
+		ParameterValue: xmlReq.ParameterValue,
+		ActCode:        code,
+		ActDescription: description,
+		RefNum:         xmlReq.RefNum,
+	}
+
+	// Marshalling a fixed struct of strings cannot fail
+	result, _ := xml.Marshal(xmlRes)
+	return result
+}
+
+// EchoXML is the answer to an echo message, carrying only its identifiers and
+// the action code.
+type EchoXML struct {
+	XMLName        xml.Name `xml:"XML"`
+	MessageType    string   `xml:"MessageType"`
+	ProcCode       string   `xml:"ProcCode"`
+	Stan           string   `xml:"STAN"`
+	RequestTime    string   `xml:"LocalTxnDtTime"`
+	ChanelID       string   `xml:"DeliveryChannelCtrlID"`
+	ActCode        string   `xml:"ActCode"`
+	ActDescription string   `xml:"ActDescription"`
+	RefNum         string   `xml:"REFNUM"`
+}
+
+// Echo builds the answer to an echo message, returning its identifiers with
+// the given action code.
+func Echo(req []byte, code, description string) []byte {
+	xmlReq, err := ParseRequest(req)
+	if err != nil {
+		xmlReq = scanRequest(req)
+	}
+
+	result, _ := xml.Marshal(&EchoXML{
+		MessageType:    "1",
+		ProcCode:       xmlReq.ProcCode,
+		Stan:           xmlReq.Stan,
+		RequestTime:    xmlReq.RequestTime,
+		ChanelID:       xmlReq.ChanelID,
+		ActCode:        code,
+		ActDescription: description,
+		RefNum:         xmlReq.RefNum,
+	})
+	return result
+}
+
+// scanRequest extracts the request fields from a message that is not well formed.
+func scanRequest(req []byte) *RequestXML {
+	return &RequestXML{
+		ProcCode:       routing.ExtractTag(req, "ProcCode"),
+		RefNum:         routing.ExtractTag(req, "REFNUM"),
+		Stan:           routing.ExtractTag(req, "STAN"),
+		RequestTime:    routing.ExtractTag(req, "LocalTxnDtTime"),
+		ChanelID:       routing.ExtractTag(req, "DeliveryChannelCtrlID"),
+		ParameterName:  routing.ExtractTag(req, "PName"),
+		ParameterValue: routing.ExtractTag(req, "PValue"),
+	}
+}
@@ -1,6 +1,8 @@
-package main
+package transform
 
 import (
+	"bytes"
+	"encoding/xml"
 	"reflect"
 	"testing"
 )
@@ -69,3 +71,78 @@ func BenchmarkResponseJ2X(b *testing.B) {
 		})
 	}
 }
+
+func TestRewriteTags(t *testing.T) {
+	msg := []byte(`<XML><STAN>111</STAN><REFNUM>222</REFNUM><PValue>1</PValue></XML>`)
+	want := []byte(`<XML><STAN>333</STAN><REFNUM>a&amp;b</REFNUM><PValue>1</PValue></XML>`)
+
+	got := RewriteTags(msg, map[string]string{"STAN": "333", "REFNUM": "a&b", "LocalTxnDtTime": "x"})
+	if !bytes.Equal(got, want) {
+		t.Errorf("RewriteTags() = %s, want %s", got, want)
+	}
+}
+
+func TestDecline(t *testing.T) {
+	req := []byte(`00000<XML><MessageType>0</MessageType><ProcCode>CSNQ</ProcCode><REFNUM>9</REFNUM><STAN>42</STAN></XML>`)
+	want := []byte(`<XML><MessageType>1</MessageType><ProcCode>CSNQ</ProcCode><STAN>42</STAN><LocalTxnDtTime></LocalTxnDtTime><DeliveryChannelCtrlID></DeliveryChannelCtrlID><PName></PName><PValue></PValue><ActCode>91</ActCode><ActDescription>System busy</ActDescription><TotalnoofTrans>0</TotalnoofTrans><Customers></Customers><REFNUM>9</REFNUM></XML>`)
+
+	if got := Decline(req, "91", "System busy"); !bytes.Equal(got, want) {
+		t.Errorf("Decline() = %s, want %s", got, want)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	req := []byte(`<XML><MessageType>0</MessageType><ProcCode>ECHO</ProcCode><STAN>42</STAN><LocalTxnDtTime>1019101500</LocalTxnDtTime></XML>`)
+	want := []byte(`<XML><MessageType>1</MessageType><ProcCode>ECHO</ProcCode><STAN>42</STAN><LocalTxnDtTime>1019101500</LocalTxnDtTime><DeliveryChannelCtrlID></DeliveryChannelCtrlID><ActCode>0</ActCode><ActDescription>Echo</ActDescription><REFNUM></REFNUM></XML>`)
+
+	if got := Echo(req, "0", "Echo"); !bytes.Equal(got, want) {
+		t.Errorf("Echo() = %s, want %s", got, want)
+	}
+}
+
+func TestConvertPage(t *testing.T) {
+	all := []byte(`{"CustomerDetails":[{"QID":"1"},{"QID":"2"},{"QID":"3"}]}`)
+	paged := []byte(`{"CustomerDetails":[{"QID":"3"}],"TotalRecords":5}`)
+
+	tests := []struct {
+		name      string
+		res       []byte
+		page      Page
+		wantQIDs  string
+		wantTotal int
+		wantMore  string
+	}{
+		{"unpaged", all, Page{}, "123", 3, ""},
+		{"first page", all, Page{Number: 1, Size: 2}, "12", 3, "Y"},
+		{"last page", all, Page{Number: 2, Size: 2}, "3", 3, "N"},
+		{"beyond last page", all, Page{Number: 5, Size: 2}, "", 3, "N"},
+		{"paged by API", paged, Page{Number: 3, Size: 1}, "3", 5, "Y"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := DefaultResults().ConvertPage(tt.res, tt.page)
+			if err != nil {
+				t.Fatalf("ConvertPage() error = %v", err)
+			}
+			var res ResponseXML
+			if err := xml.Unmarshal(got, &res); err != nil {
+				t.Fatalf("ConvertPage() = %s, not XML: %v", got, err)
+			}
+
+			var qids string
+			for _, r := range res.Customers.Records {
+				qids += r.QID
+			}
+			if qids != tt.wantQIDs {
+				t.Errorf("ConvertPage() records = %q, want %q", qids, tt.wantQIDs)
+			}
+			if total != tt.wantTotal || res.TotalnoofTrans != tt.wantTotal {
+				t.Errorf("ConvertPage() total = %d, TotalnoofTrans = %d, want %d", total, res.TotalnoofTrans, tt.wantTotal)
+			}
+			if res.MoreRecords != tt.wantMore || res.PageNo != tt.page.Number {
+				t.Errorf("ConvertPage() PageNo = %d, MoreRecords = %q, want %d, %q",
+					res.PageNo, res.MoreRecords, tt.page.Number, tt.wantMore)
+			}
+		})
+	}
+}
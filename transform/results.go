@@ -0,0 +1,73 @@
+package transform
+
+// Result is an action code and description returned to the channel.
+type Result struct {
+	Code        string
+	Description string
+}
+
+// Results maps API business outcomes to action codes. A result with an empty
+// code is not applied, leaving the Success result in place.
+type Results struct {
+	Success     Result
+	NotFound    Result         // no customer in the response
+	Blacklisted Result         // every customer in the response is blacklisted
+	UseMessage  bool           // use the API message field as the description when present
+	Status      map[int]Result // non-200 HTTP status codes answered with an action code
+	DateLayout  string         // time layout of record dates, DefaultDateLayout when empty
+
+	// CustomerFlags appends GUID, Blacklisted and NationalityWithdrawn to each record
+	CustomerFlags bool
+}
+
+// DefaultResults answers every successful API response with action code 0.
+func DefaultResults() Results {
+	return Results{Success: Result{Code: "0", Description: "Success"}}
+}
+
+// classify returns the result of a successful API response with total
+// customers across all pages. A page past the last one is a success.
+func (r Results) classify(res *ResponseJSON, total int) Result {
+	result := r.Success
+	switch {
+	case total == 0:
+		result = pick(r.NotFound, result)
+	case len(res.Customers) > 0 && allBlacklisted(res.Customers):
+		result = pick(r.Blacklisted, result)
+	}
+	if r.UseMessage && res.Message != "" {
+		result.Description = res.Message
+	}
+	return result
+}
+
+// ForStatus returns the result of an API error response with the given HTTP
+// status and message, and whether the status is mapped.
+func (r Results) ForStatus(status int, message string) (Result, bool) {
+	result, ok := r.Status[status]
+	if !ok || result.Code == "" {
+		return Result{}, false
+	}
+	if r.UseMessage && message != "" {
+		result.Description = message
+	}
+	return result, true
+}
+
+// pick returns result when it has a code and fallback otherwise.
+func pick(result, fallback Result) Result {
+	if result.Code == "" {
+		return fallback
+	}
+	return result
+}
+
+// allBlacklisted reports whether every customer is blacklisted.
+func allBlacklisted(customers []Details) bool {
+	for _, c := range customers {
+		if !c.IsBlacklisted {
+			return false
+		}
+	}
+	return true
+}
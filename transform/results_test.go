@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResultsConvert(t *testing.T) {
+	results := DefaultResults()
+	results.NotFound = Result{Code: "25", Description: "Customer not found"}
+	results.Blacklisted = Result{Code: "62", Description: "Customer blacklisted"}
+
+	withMessage := results
+	withMessage.UseMessage = true
+
+	tests := []struct {
+		name      string
+		results   Results
+		res       string
+		wantCode  string
+		wantDesc  string
+		wantFound int
+	}{
+		{"found", results, `{"CustomerDetails":[{"BASENO":"1"},{"BASENO":"2","IsBlacklisted":true}]}`, "0", "Success", 2},
+		{"not found", results, `{"CustomerDetails":[]}`, "25", "Customer not found", 0},
+		{"page past the last", results, `{"CustomerDetails":[],"TotalRecords":5}`, "0", "Success", 5},
+		{"all blacklisted", results, `{"CustomerDetails":[{"BASENO":"1","IsBlacklisted":true}]}`, "62", "Customer blacklisted", 1},
+		{"unmapped not found", DefaultResults(), `{"CustomerDetails":[]}`, "0", "Success", 0},
+		{"message as description", withMessage, `{"CustomerDetails":[],"message":"No match"}`, "25", "No match", 0},
+		{"message ignored", results, `{"CustomerDetails":[],"message":"No match"}`, "25", "Customer not found", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found, err := tt.results.Convert([]byte(tt.res))
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			if found != tt.wantFound {
+				t.Errorf("Convert() found = %d, want %d", found, tt.wantFound)
+			}
+			for _, want := range []string{
+				"<ActCode>" + tt.wantCode + "</ActCode>",
+				"<ActDescription>" + tt.wantDesc + "</ActDescription>",
+			} {
+				if !bytes.Contains(got, []byte(want)) {
+					t.Errorf("Convert() = %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResultsForStatus(t *testing.T) {
+	results := Results{
+		UseMessage: true,
+		Status:     map[int]Result{404: {Code: "25", Description: "Not found"}, 500: {}},
+	}
+
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		want    Result
+		wantOK  bool
+	}{
+		{"mapped", 404, "", Result{"25", "Not found"}, true},
+		{"mapped with message", 404, "No such customer", Result{"25", "No such customer"}, true},
+		{"empty code", 500, "", Result{}, false},
+		{"unmapped", 503, "", Result{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := results.ForStatus(tt.status, tt.message)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ForStatus() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/limit"
+	"github.com/andrei-cloud/netfwd/routing"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// API is a client of the customer HTTP API with optional response caching,
+// request coalescing and a concurrency limit.
+type API struct {
+	url      *url.URL
+	auth     string
+	client   *http.Client
+	routes   map[string]route  // per ProcCode routes besides CSNQ
+	results  transform.Results // action codes of API outcomes
+	pageSize int               // records per CSNQ response, 0 for all
+
+	cache  *ResponseCache // nil when caching is disabled
+	flight *flightGroup   // nil when coalescing is disabled
+
+	maxRequests        int // concurrent requests per backend host, 0 for unlimited
+	semMu              sync.Mutex
+	sems               map[string]limit.Semaphore // by backend host
+	policy             limit.Policy
+	declineCode        string
+	declineDescription string
+}
+
+// route is how messages of a ProcCode are sent to the API.
+type route struct {
+	generic bool
+	url     *url.URL
+}
+
+// NewAPI creates an API client from the configuration.
+func NewAPI(cfg *config.Config) (*API, error) {
+	if cfg.API.URL == "" {
+		return nil, errors.New("destination HTTP endpoint is required")
+	}
+	if cfg.API.Username == "" || cfg.API.Password == "" {
+		return nil, errors.New("username and password must be provided")
+	}
+
+	// Parse and validate destination URL
+	u, err := url.Parse(cfg.API.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination URL: %w", err)
+	}
+
+	a := &API{
+		url:                u,
+		auth:               base64.StdEncoding.EncodeToString([]byte(cfg.API.Username + ":" + cfg.API.Password)),
+		client:             NewHTTPClient(),
+		policy:             cfg.Limits.APIPolicy,
+		declineCode:        cfg.Limits.DeclineCode,
+		declineDescription: cfg.Limits.DeclineDescription,
+		routes:             make(map[string]route),
+		results:            newResults(cfg.API.Results),
+		pageSize:           cfg.API.Paging.PageSize,
+	}
+
+	for code, rc := range cfg.API.Routes {
+		r := route{url: u}
+		switch rc.Mode {
+		case "", config.GenericMode:
+			r.generic = true
+		case config.CSNQMode:
+		default:
+			return nil, fmt.Errorf("route %s: unknown mode %q", code, rc.Mode)
+		}
+		if rc.URL != "" {
+			if r.url, err = url.Parse(rc.URL); err != nil {
+				return nil, fmt.Errorf("route %s: invalid URL: %w", code, err)
+			}
+		}
+		a.routes[code] = r
+	}
+
+	if cfg.Cache.Enabled {
+		a.cache = NewResponseCache(cfg.Cache)
+		slog.Info("Response cache enabled",
+			"keyFields", cfg.Cache.KeyFields,
+			"ttl", cfg.Cache.TTL.String(),
+			"maxEntries", cfg.Cache.MaxEntries)
+	}
+
+	if cfg.Coalesce.Enabled {
+		a.flight = newFlightGroup()
+		slog.Info("API request coalescing enabled")
+	}
+
+	if cfg.Limits.MaxAPIRequests > 0 {
+		a.maxRequests = cfg.Limits.MaxAPIRequests
+		a.sems = make(map[string]limit.Semaphore)
+	}
+
+	return a, nil
+}
+
+// newResults builds the result mapping from its configuration.
+func newResults(cfg config.ResultsConfig) transform.Results {
+	results := transform.DefaultResults()
+	results.NotFound = transform.Result(cfg.NotFound)
+	results.Blacklisted = transform.Result(cfg.Blacklisted)
+	results.UseMessage = cfg.UseMessage
+	results.DateLayout = cfg.DateLayout
+	results.CustomerFlags = cfg.CustomerFlags
+	results.Status = make(map[int]transform.Result, len(cfg.Status))
+	for status, rc := range cfg.Status {
+		results.Status[status] = transform.Result(rc)
+	}
+	return results
+}
+
+// NewHTTPClient creates a preconfigured HTTP client.
+func NewHTTPClient() *http.Client {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// Handle sends a message to the API using the route of its ProcCode.
+// Messages without a configured route use the CSNQ schema.
+func (a *API) Handle(ctx context.Context, f framing.Framer, req *[]byte) (*[]byte, error) {
+	r, ok := a.routes[routing.ExtractTag(*req, "ProcCode")]
+	switch {
+	case !ok:
+		return a.CSNQ(ctx, f, req)
+	case r.generic:
+		return a.generic(ctx, f, req, r.url)
+	default:
+		return a.csnq(ctx, f, req, r.url)
+	}
+}
+
+// CSNQ handles the transformation of messages to HTTP API calls and back.
+func (a *API) CSNQ(ctx context.Context, f framing.Framer, req *[]byte) (*[]byte, error) {
+	return a.csnq(ctx, f, req, a.url)
+}
+
+// csnq converts a message with the CSNQ schema and sends it to the endpoint u.
+func (a *API) csnq(ctx context.Context, f framing.Framer, req *[]byte, u *url.URL) (*[]byte, error) {
+	// Parse the XML request
+	xmlReq, err := transform.ParseRequest(*req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform XML to JSON: %w", err)
+	}
+
+	page := xmlReq.Page(a.pageSize)
+
+	// Serve from cache when possible, echoing this request's identifiers
+	var key string
+	cacheable := false
+	if a.cache != nil {
+		key, cacheable = a.cache.Key(xmlReq)
+		if page.Size > 0 {
+			key += "|page=" + strconv.Itoa(page.Number)
+		}
+		if cacheable {
+			if cached, ok := a.cache.Get(key); ok {
+				return f.Frame(transform.RewriteTags(cached, transform.IdentityTags(xmlReq))), nil
+			}
+		}
+	}
+
+	// Transform XML request to JSON
+	request, err := xmlReq.PageJSON(page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform XML to JSON: %w", err)
+	}
+
+	var response []byte
+	var found int
+	if a.flight != nil {
+		// Share one upstream call between identical concurrent requests, which
+		// must not fail when the request that started it is canceled
+		var shared bool
+		response, found, shared, err = a.flight.Do(coalesceKey(xmlReq, u, page), func() ([]byte, int, error) {
+			return a.call(context.WithoutCancel(ctx), u, request, page)
+		})
+		if err == nil && shared {
+			response = transform.RewriteTags(response, transform.IdentityTags(xmlReq))
+		}
+	} else {
+		response, found, err = a.call(ctx, u, request, page)
+	}
+	if err != nil {
+		return a.failed(f, req, err)
+	}
+
+	if cacheable {
+		a.cache.Set(key, xmlReq.ProcCode, response, found == 0)
+	}
+
+	return f.Frame(response), nil
+}
+
+// generic converts a message with the generic XML to JSON convention, sends it to
+// the endpoint u and converts the JSON response back to XML.
+func (a *API) generic(ctx context.Context, f framing.Framer, req *[]byte, u *url.URL) (*[]byte, error) {
+	request, err := transform.XMLToJSON(f.Body(*req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform XML to JSON: %w", err)
+	}
+
+	status, body, err := a.post(ctx, u, request)
+	if err != nil {
+		return a.failed(f, req, err)
+	}
+	if status != http.StatusOK {
+		return a.failed(f, req, processErrorResponse(status, body))
+	}
+
+	response, err := transform.JSONToXML(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform JSON response to XML: %w", err)
+	}
+	return f.Frame(response), nil
+}
+
+// failed answers a request whose API call failed with the decline XML when the
+// concurrency limit declined it or the HTTP status is mapped to an action code,
+// and returns the error otherwise.
+func (a *API) failed(f framing.Framer, req *[]byte, err error) (*[]byte, error) {
+	var le *limit.Error
+	if errors.As(err, &le) && le.Policy == limit.Decline {
+		return f.Frame(transform.Decline(*req, a.declineCode, a.declineDescription)), nil
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		if result, ok := a.results.ForStatus(se.Status, se.Message); ok {
+			return f.Frame(transform.Decline(*req, result.Code, result.Description)), nil
+		}
+	}
+	return nil, err
+}
+
+// coalesceKey identifies requests that would produce the same API response for
+// page p from the endpoint u, ignoring the per-request STAN, REFNUM and request
+// time. The JSON request carries no ProcCode, so it is part of the key.
+func coalesceKey(req *transform.RequestXML, u *url.URL, p transform.Page) string {
+	anon := *req
+	anon.Stan, anon.RefNum, anon.RequestTime = "", "", ""
+	key, _ := anon.PageJSON(p)
+	return req.ProcCode + "|" + u.String() + "|" + string(key)
+}
+
+// semaphore returns the concurrency limit of the backend host, or nil when
+// concurrency is unlimited.
+func (a *API) semaphore(host string) limit.Semaphore {
+	if a.sems == nil {
+		return nil
+	}
+	a.semMu.Lock()
+	defer a.semMu.Unlock()
+	sem, ok := a.sems[host]
+	if !ok {
+		sem = limit.NewSemaphore(a.maxRequests)
+		a.sems[host] = sem
+	}
+	return sem
+}
+
+// acquire takes a concurrent request slot of the backend host, applying the
+// over-limit policy. Queued requests wait until ctx ends.
+func (a *API) acquire(ctx context.Context, host string) error {
+	sem := a.semaphore(host)
+	if sem == nil {
+		return nil
+	}
+	if a.policy == limit.Queue {
+		return sem.Acquire(ctx)
+	}
+	if sem.TryAcquire() {
+		return nil
+	}
+
+	limitedAPIRequests.Add(1)
+	if a.policy == limit.Close {
+		return &limit.Error{Policy: limit.Close}
+	}
+	return &limit.Error{Policy: limit.Decline}
+}
+
+// release frees a concurrent request slot of the backend host.
+func (a *API) release(host string) {
+	if sem := a.semaphore(host); sem != nil {
+		sem.Release()
+	}
+}
+
+// call sends a JSON request to the HTTP API and returns the XML response for
+// page p together with the number of customers found.
+func (a *API) call(ctx context.Context, u *url.URL, request []byte, p transform.Page) ([]byte, int, error) {
+	status, body, err := a.post(ctx, u, request)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Process response based on status code
+	if status == http.StatusOK {
+		response, found, err := a.results.ConvertPage(body, p)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to transform JSON response to XML: %w", err)
+		}
+		return response, found, nil
+	}
+
+	// Handle error responses
+	return nil, 0, processErrorResponse(status, body)
+}
+
+// post sends a JSON request to the endpoint u and returns the status code and body.
+func (a *API) post(ctx context.Context, u *url.URL, request []byte) (int, []byte, error) {
+	// Bound concurrent requests to the backend
+	if err := a.acquire(ctx, u.Host); err != nil {
+		return 0, nil, err
+	}
+	defer a.release(u.Host)
+
+	// Create HTTP request with the JSON body
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(request))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	// Set headers
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "go-frwd/0.0.1")
+
+	// Add Basic Authentication
+	httpReq.Header.Set("Authorization", "Basic "+a.auth)
+
+	// Make the API call
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return 0, nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read the response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// StatusError is an API error response.
+type StatusError struct {
+	Status  int    // HTTP status code
+	Message string // message field of the response, empty if unparseable
+}
+
+// Error implements error.
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API error (status %d)", e.Status)
+	}
+	return "API error: " + e.Message
+}
+
+// processErrorResponse extracts error information from the API response
+func processErrorResponse(status int, body []byte) error {
+	errResponse := struct {
+		Message string `json:"message"`
+	}{}
+
+	// An unparseable body leaves the message empty
+	_ = json.Unmarshal(body, &errResponse)
+
+	return &StatusError{Status: status, Message: errResponse.Message}
+}
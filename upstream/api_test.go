@@ -0,0 +1,293 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/limit"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+func TestNewAPI(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     config.APIConfig
+		wantErr bool
+	}{
+		{"valid", config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p"}, false},
+		{"missing credentials", config.APIConfig{URL: "http://localhost:3030/"}, true},
+		{"missing url", config.APIConfig{Username: "u", Password: "p"}, true},
+		{"generic route", config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p",
+			Routes: map[string]config.RouteConfig{"ACNQ": {URL: "http://localhost:3030/accounts"}}}, false},
+		{"unknown route mode", config.APIConfig{URL: "http://localhost:3030/", Username: "u", Password: "p",
+			Routes: map[string]config.RouteConfig{"ACNQ": {Mode: "soap"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.API = tt.api
+			if _, err := NewAPI(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("NewAPI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"CustomerDetails":[]}`))
+	}))
+	defer srv.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"STAN":"1"}`))
+	}))
+	defer other.Close()
+
+	newAPI := func(policy limit.Policy) *API {
+		cfg := config.Default()
+		cfg.API = config.APIConfig{URL: srv.URL, Username: "u", Password: "p",
+			Routes: map[string]config.RouteConfig{"ACNQ": {URL: other.URL}}}
+		cfg.Limits.MaxAPIRequests = 1
+		cfg.Limits.APIPolicy = policy
+		api, err := NewAPI(cfg)
+		if err != nil {
+			t.Fatalf("NewAPI() error = %v", err)
+		}
+		// Hold the only slot of the CSNQ backend
+		if err := api.acquire(context.Background(), api.url.Host); err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+		t.Cleanup(func() { api.release(api.url.Host) })
+		return api
+	}
+	req := []byte(`00000<XML><ProcCode>CSNQ</ProcCode><STAN>1</STAN><PValue>157336</PValue></XML>`)
+
+	t.Run("decline", func(t *testing.T) {
+		api := newAPI(limit.Decline)
+		res, err := api.CSNQ(context.Background(), framing.Default, &req)
+		if err != nil {
+			t.Fatalf("CSNQ() error = %v", err)
+		}
+		if !bytes.Contains(*res, []byte("<ActCode>91</ActCode>")) {
+			t.Errorf("CSNQ() = %s, want decline", *res)
+		}
+
+		// Other backends keep their own slots
+		acnq := []byte(`00000<XML><ProcCode>ACNQ</ProcCode><STAN>1</STAN></XML>`)
+		if res, err := api.Handle(context.Background(), framing.Default, &acnq); err != nil || bytes.Contains(*res, []byte("<ActCode>91</ActCode>")) {
+			t.Errorf("Handle() = %s, %v, want the other backend's response", *res, err)
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		api := newAPI(limit.Queue)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := api.CSNQ(ctx, framing.Default, &req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("CSNQ() error = %v, want the request context's error", err)
+		}
+	})
+
+	close(release)
+}
+
+func TestAPIGenericRoute(t *testing.T) {
+	var got []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/accounts" {
+			http.NotFound(w, r)
+			return
+		}
+		got, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"STAN":"1","Accounts":{"Account":[{"@type":"CA","#text":"100"},{"@type":"SA","#text":"200"}]}}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.API = config.APIConfig{URL: srv.URL, Username: "u", Password: "p",
+		Routes: map[string]config.RouteConfig{"ACNQ": {Mode: config.GenericMode, URL: srv.URL + "/accounts"}}}
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatalf("NewAPI() error = %v", err)
+	}
+
+	req := *framing.Default.Frame([]byte(`<XML><ProcCode>ACNQ</ProcCode><STAN>1</STAN><Customer><Id>7</Id></Customer></XML>`))
+	res, err := api.Handle(context.Background(), framing.Default, &req)
+	if err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	if want := `{"ProcCode":"ACNQ","STAN":"1","Customer":{"Id":"7"}}`; string(got) != want {
+		t.Errorf("API request = %s, want %s", got, want)
+	}
+	want := `<XML><STAN>1</STAN><Accounts><Account type="CA">100</Account><Account type="SA">200</Account></Accounts></XML>`
+	if body := string((*res)[framing.DefaultLengthSize:]); body != want {
+		t.Errorf("Handle() = %s, want %s", body, want)
+	}
+}
+
+func TestAPIStatusResults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Customer does not exist"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`oops`))
+		}
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.API = config.APIConfig{URL: srv.URL + "/missing", Username: "u", Password: "p",
+		Routes: map[string]config.RouteConfig{"CSNF": {Mode: config.CSNQMode, URL: srv.URL + "/fail"}},
+		Results: config.ResultsConfig{
+			UseMessage: true,
+			Status:     map[int]config.ResultCode{http.StatusNotFound: {Code: "25", Description: "Not found"}},
+		}}
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatalf("NewAPI() error = %v", err)
+	}
+
+	req := *framing.Default.Frame([]byte(`<XML><ProcCode>CSNQ</ProcCode><STAN>9</STAN><PValue>1</PValue></XML>`))
+	res, err := api.Handle(context.Background(), framing.Default, &req)
+	if err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	for _, want := range []string{"<STAN>9</STAN>", "<ActCode>25</ActCode>", "<ActDescription>Customer does not exist</ActDescription>"} {
+		if !bytes.Contains(*res, []byte(want)) {
+			t.Errorf("Handle() = %s, want %s", *res, want)
+		}
+	}
+
+	// Unmapped statuses are still errors
+	req = *framing.Default.Frame([]byte(`<XML><ProcCode>CSNF</ProcCode><STAN>10</STAN></XML>`))
+	_, err = api.Handle(context.Background(), framing.Default, &req)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Status != http.StatusInternalServerError {
+		t.Errorf("Handle() error = %v, want status error 500", err)
+	}
+}
+
+func TestAPIPaging(t *testing.T) {
+	var pages []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req transform.RequestJSON
+		json.NewDecoder(r.Body).Decode(&req)
+		pages = append(pages, fmt.Sprintf("%d/%d", req.PageNumber, req.PageSize))
+		// An API ignoring the paging parameters returns every customer
+		w.Write([]byte(`{"RequestInfo":{"requestId":"1"},"CustomerDetails":[` +
+			`{"FirstName":"A"},{"FirstName":"B"},{"FirstName":"C"}]}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.API = config.APIConfig{URL: srv.URL, Username: "u", Password: "p",
+		Paging: config.PagingConfig{PageSize: 2}}
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatalf("NewAPI() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		req  string
+		want []string
+	}{
+		{"first page", `<XML><ProcCode>CSNQ</ProcCode><PValue>1</PValue></XML>`,
+			[]string{"<TotalnoofTrans>3</TotalnoofTrans><PageNo>1</PageNo><MoreRecords>Y</MoreRecords>",
+				"<FirstName>A</FirstName>", "<FirstName>B</FirstName>"}},
+		{"last page", `<XML><ProcCode>CSNQ</ProcCode><PValue>1</PValue><PageNo>2</PageNo></XML>`,
+			[]string{"<TotalnoofTrans>3</TotalnoofTrans><PageNo>2</PageNo><MoreRecords>N</MoreRecords>",
+				"<FirstName>C</FirstName>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := *framing.Default.Frame([]byte(tt.req))
+			res, err := api.Handle(context.Background(), framing.Default, &req)
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !bytes.Contains(*res, []byte(want)) {
+					t.Errorf("Handle() = %s, want %s", *res, want)
+				}
+			}
+			if n := bytes.Count(*res, []byte("<Record>")); n != len(tt.want)-1 {
+				t.Errorf("Handle() returned %d records, want %d", n, len(tt.want)-1)
+			}
+		})
+	}
+
+	if want := []string{"1/2", "2/2"}; !slices.Equal(pages, want) {
+		t.Errorf("API requested pages %v, want %v", pages, want)
+	}
+}
+
+func TestAPICoalesceRoutes(t *testing.T) {
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		<-release
+		fmt.Fprintf(w, `{"CustomerDetails":[{"BASENO":"157336","FirstName":"%s"}]}`, r.URL.Path[1:])
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.API = config.APIConfig{URL: srv.URL + "/retail", Username: "u", Password: "p",
+		Routes: map[string]config.RouteConfig{"CSNB": {Mode: config.CSNQMode, URL: srv.URL + "/business"}}}
+	cfg.Coalesce.Enabled = true
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatalf("NewAPI() error = %v", err)
+	}
+
+	// Both requests must reach their own endpoint, not share the first call
+	results := make(map[string]chan string)
+	for _, code := range []string{"CSNQ", "CSNB"} {
+		results[code] = make(chan string, 1)
+		go func() {
+			req := *framing.Default.Frame([]byte(`<XML><ProcCode>` + code + `</ProcCode><STAN>1</STAN><PValue>157336</PValue></XML>`))
+			res, err := api.Handle(context.Background(), framing.Default, &req)
+			if err != nil {
+				results[code] <- err.Error()
+				return
+			}
+			results[code] <- string(*res)
+		}()
+	}
+	waitDone := make(chan struct{})
+	go func() { arrived.Wait(); close(waitDone) }()
+	select {
+	case <-waitDone:
+	case <-time.After(2 * time.Second):
+		close(release)
+		t.Fatal("requests of different routes were coalesced into one API call")
+	}
+	close(release)
+
+	for code, want := range map[string]string{"CSNQ": "<FirstName>retail</FirstName>", "CSNB": "<FirstName>business</FirstName>"} {
+		if got := <-results[code]; !strings.Contains(got, want) {
+			t.Errorf("Handle(%s) = %s, want %s", code, got, want)
+		}
+	}
+}
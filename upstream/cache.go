@@ -0,0 +1,140 @@
+package upstream
+
+import (
+	"container/list"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/metrics"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+// API metrics
+var (
+	cacheHits      = metrics.NewCounter("cache_hits")
+	cacheMisses    = metrics.NewCounter("cache_misses")
+	cacheEvictions = metrics.NewCounter("cache_evictions")
+
+	limitedAPIRequests = metrics.NewCounter("limited_api_requests")
+)
+
+// ResponseCache is a size-bounded LRU cache of XML API responses with per-entry expiry.
+type ResponseCache struct {
+	mu    sync.Mutex
+	cfg   config.CacheConfig
+	items map[string]*list.Element
+	lru   *list.List
+	size  int
+}
+
+// cacheEntry is a single cached response.
+type cacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewResponseCache creates a cache from its configuration.
+func NewResponseCache(cfg config.CacheConfig) *ResponseCache {
+	return &ResponseCache{
+		cfg:   cfg,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// Key builds the cache key for a request from the configured fields.
+// It returns false when the request's ProcCode bypasses the cache.
+func (c *ResponseCache) Key(req *transform.RequestXML) (string, bool) {
+	if slices.Contains(c.cfg.Bypass, req.ProcCode) {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i, field := range c.cfg.KeyFields {
+		if i > 0 {
+			b.WriteByte('|')
+		}
+		b.WriteString(req.Field(field))
+	}
+	return b.String(), true
+}
+
+// Get returns a cached response body if present and not expired.
+func (c *ResponseCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		cacheMisses.Add(1)
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(el)
+		cacheMisses.Add(1)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	cacheHits.Add(1)
+	return entry.value, true
+}
+
+// Set stores a response body for the given route. Negative entries use the negative TTL.
+func (c *ResponseCache) Set(key, procCode string, value []byte, negative bool) {
+	ttl := c.ttl(procCode, negative)
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+
+	entry := &cacheEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	c.items[key] = c.lru.PushFront(entry)
+	c.size += len(value)
+
+	// Enforce size bounds, evicting least recently used entries first
+	for c.lru.Len() > 0 &&
+		((c.cfg.MaxEntries > 0 && c.lru.Len() > c.cfg.MaxEntries) ||
+			(c.cfg.MaxBytes > 0 && c.size > c.cfg.MaxBytes)) {
+		c.remove(c.lru.Back())
+		cacheEvictions.Add(1)
+	}
+}
+
+// Len returns the number of cached entries.
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// ttl returns the time to live for a route.
+func (c *ResponseCache) ttl(procCode string, negative bool) time.Duration {
+	if negative {
+		return c.cfg.NegativeTTL.Duration
+	}
+	if d, ok := c.cfg.RouteTTL[procCode]; ok {
+		return d.Duration
+	}
+	return c.cfg.TTL.Duration
+}
+
+// remove deletes an element; the caller must hold the lock.
+func (c *ResponseCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.items, entry.key)
+	c.size -= len(entry.value)
+}
@@ -0,0 +1,133 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/config"
+	"github.com/andrei-cloud/netfwd/framing"
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+func TestResponseCache(t *testing.T) {
+	cfg := config.CacheConfig{
+		Enabled:     true,
+		KeyFields:   []string{"ProcCode", "PValue"},
+		MaxEntries:  2,
+		TTL:         config.Duration{Duration: time.Minute},
+		NegativeTTL: config.Duration{Duration: time.Millisecond},
+		RouteTTL:    map[string]config.Duration{"CSNQ": {Duration: time.Hour}},
+		Bypass:      []string{"CRNQ"},
+	}
+	c := NewResponseCache(cfg)
+
+	key, ok := c.Key(&transform.RequestXML{ProcCode: "CSNQ", ParameterValue: "157336", Stan: "1"})
+	if !ok || key != "CSNQ|157336" {
+		t.Fatalf("Key() = %q, %v", key, ok)
+	}
+	if _, ok := c.Key(&transform.RequestXML{ProcCode: "CRNQ"}); ok {
+		t.Errorf("Key() expected bypass for CRNQ")
+	}
+
+	c.Set(key, "CSNQ", []byte("a"), false)
+	if got, ok := c.Get(key); !ok || string(got) != "a" {
+		t.Errorf("Get() = %q, %v", got, ok)
+	}
+
+	// Negative entries expire with the negative TTL
+	c.Set("missing", "CSNQ", []byte("b"), true)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("missing"); ok {
+		t.Errorf("Get() expected negative entry to expire")
+	}
+
+	// Oldest entries are evicted beyond MaxEntries
+	c.Set("k2", "CSNQ", []byte("c"), false)
+	c.Set("k3", "CSNQ", []byte("d"), false)
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+	if _, ok := c.Get(key); ok {
+		t.Errorf("Get() expected %q to be evicted", key)
+	}
+}
+
+func TestCSNQCache(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"RequestInfo":{"requestId":"1","userId":"1","basenumber":"157336","requestTime":"1"},"CustomerDetails":[{"BASENO":"157336"}]}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.API = config.APIConfig{URL: srv.URL, Username: "u", Password: "p"}
+	cfg.Cache.Enabled = true
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatalf("NewAPI() error = %v", err)
+	}
+
+	for _, stan := range []string{"1", "2"} {
+		req := []byte(`00000<XML><ProcCode>CSNQ</ProcCode><REFNUM>` + stan + `</REFNUM><STAN>` + stan +
+			`</STAN><LocalTxnDtTime>` + stan + `</LocalTxnDtTime><PName>ACCOUNTNUMBER</PName><PValue>157336</PValue></XML>`)
+		res, err := api.CSNQ(context.Background(), framing.Default, &req)
+		if err != nil {
+			t.Fatalf("CSNQ() error = %v", err)
+		}
+		if !bytes.Contains(*res, []byte("<STAN>"+stan+"</STAN>")) ||
+			!bytes.Contains(*res, []byte("<REFNUM>"+stan+"</REFNUM>")) {
+			t.Errorf("CSNQ() = %s, want STAN/REFNUM %s", *res, stan)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("API calls = %d, want 1", calls)
+	}
+}
+
+func TestCSNQCacheChannels(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var req struct {
+			Info struct {
+				ChanelID string `json:"chanelId"`
+			} `json:"RequestInfo"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprintf(w, `{"RequestInfo":{"requestId":"1","basenumber":"157336","chanelId":%q},"CustomerDetails":[{"BASENO":"157336"}]}`,
+			req.Info.ChanelID)
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.API = config.APIConfig{URL: srv.URL, Username: "u", Password: "p"}
+	cfg.Cache.Enabled = true
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatalf("NewAPI() error = %v", err)
+	}
+
+	// The cached response of an IVR request answers a POS one
+	for _, channel := range []string{"IVR", "POS"} {
+		req := *framing.Default.Frame([]byte(`<XML><ProcCode>CSNQ</ProcCode><STAN>1</STAN><DeliveryChannelCtrlID>` +
+			channel + `</DeliveryChannelCtrlID><PName>ACCOUNTNUMBER</PName><PValue>157336</PValue></XML>`))
+		res, err := api.CSNQ(context.Background(), framing.Default, &req)
+		if err != nil {
+			t.Fatalf("CSNQ() error = %v", err)
+		}
+		if want := "<DeliveryChannelCtrlID>" + channel + "</DeliveryChannelCtrlID>"; !bytes.Contains(*res, []byte(want)) {
+			t.Errorf("CSNQ() = %s, want %s", *res, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("API calls = %d, want 1", calls)
+	}
+}
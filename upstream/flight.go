@@ -0,0 +1,56 @@
+package upstream
+
+import (
+	"sync"
+
+	"github.com/andrei-cloud/netfwd/metrics"
+)
+
+// Coalescing metrics
+var coalescedRequests = metrics.NewCounter("coalesced_requests")
+
+// flightGroup runs at most one call per key at a time; concurrent callers
+// with the same key wait for and share the result of the first one.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is an in-flight or completed call.
+type flightCall struct {
+	wg    sync.WaitGroup
+	val   []byte
+	found int
+	err   error
+}
+
+// newFlightGroup creates an empty flight group.
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// Do executes fn once for all concurrent callers with the same key.
+// The shared result reports whether the value came from another caller's call.
+func (g *flightGroup) Do(key string, fn func() ([]byte, int, error)) ([]byte, int, bool, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		coalescedRequests.Add(1)
+		c.wg.Wait()
+		return c.val, c.found, true, c.err
+	}
+
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.found, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.val, c.found, false, c.err
+}
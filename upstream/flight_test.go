@@ -0,0 +1,82 @@
+package upstream
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/transform"
+)
+
+func TestFlightGroup(t *testing.T) {
+	g := newFlightGroup()
+	release := make(chan struct{})
+	calls := 0
+
+	fn := func() ([]byte, int, error) {
+		calls++
+		<-release
+		return []byte("res"), 1, nil
+	}
+
+	const callers = 5
+	before := coalescedRequests.Value()
+
+	var wg sync.WaitGroup
+	results := make([]string, callers)
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			val, _, _, err := g.Do("key", fn)
+			if err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+			results[i] = string(val)
+		}(i)
+	}
+
+	// Wait for every follower to join the in-flight call before releasing it
+	deadline := time.Now().Add(time.Second)
+	for coalescedRequests.Value()-before < callers-1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+	for i, r := range results {
+		if r != "res" {
+			t.Errorf("results[%d] = %q, want %q", i, r, "res")
+		}
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	a := &transform.RequestXML{ProcCode: "CSNQ", Stan: "1", RefNum: "1", RequestTime: "1", ParameterValue: "157336"}
+	b := &transform.RequestXML{ProcCode: "CSNQ", Stan: "2", RefNum: "2", RequestTime: "2", ParameterValue: "157336"}
+	c := &transform.RequestXML{ProcCode: "CSNQ", Stan: "1", RefNum: "1", RequestTime: "1", ParameterValue: "157337"}
+	d := &transform.RequestXML{ProcCode: "CSNB", Stan: "1", RefNum: "1", RequestTime: "1", ParameterValue: "157336"}
+	u, _ := url.Parse("http://localhost:3030/customers")
+	other, _ := url.Parse("http://localhost:3030/business")
+
+	first := transform.Page{Number: 1, Size: 10}
+	if coalesceKey(a, u, first) != coalesceKey(b, u, first) {
+		t.Errorf("coalesceKey() differs for requests with only identity fields changed")
+	}
+	if coalesceKey(a, u, first) == coalesceKey(c, u, first) {
+		t.Errorf("coalesceKey() equal for different base numbers")
+	}
+	if coalesceKey(a, u, first) == coalesceKey(a, u, transform.Page{Number: 2, Size: 10}) {
+		t.Errorf("coalesceKey() equal for different pages")
+	}
+	if coalesceKey(a, u, first) == coalesceKey(d, u, first) {
+		t.Errorf("coalesceKey() equal for different ProcCodes")
+	}
+	if coalesceKey(a, u, first) == coalesceKey(a, other, first) {
+		t.Errorf("coalesceKey() equal for different endpoints")
+	}
+}
@@ -0,0 +1,190 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+// ErrPoolClosed is returned by a closed pool
+var ErrPoolClosed = errors.New("connection pool closed")
+
+// DialFunc opens a connection to a forward host.
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// Pool keeps idle connections to a forward host for request/response exchanges.
+// A connection carries one exchange at a time and is dropped after an error.
+type Pool struct {
+	dial    DialFunc
+	framer  framing.Framer
+	timeout time.Duration
+
+	mu     sync.Mutex
+	idle   []*idleConn
+	size   int
+	closed bool
+}
+
+// NewPool creates a pool keeping up to size idle connections to addr.
+// Each exchange must complete within timeout.
+func NewPool(addr string, f framing.Framer, size int, timeout time.Duration) *Pool {
+	var dialer net.Dialer
+	return NewDialPool(func(ctx context.Context) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}, f, size, timeout)
+}
+
+// NewDialPool creates a pool like NewPool, opening its connections with dial,
+// e.g. to pick among several forward hosts.
+func NewDialPool(dial DialFunc, f framing.Framer, size int, timeout time.Duration) *Pool {
+	return &Pool{dial: dial, framer: f, size: size, timeout: timeout}
+}
+
+// Forward sends a framed message to the forward host and returns the framed response.
+// An idle connection closed by the host is replaced by a new one.
+func (p *Pool) Forward(ctx context.Context, msg *[]byte) (*[]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	conn, reused, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a message that never left is sent again: once the host received
+	// it, it may have been processed even though no response came back
+	res, sent, err := p.exchange(ctx, conn, msg)
+	if reused && !sent && err != nil && ctx.Err() == nil {
+		if conn, err = p.dial(ctx); err != nil {
+			return nil, err
+		}
+		res, _, err = p.exchange(ctx, conn, msg)
+	}
+	return res, err
+}
+
+// exchange sends a message on conn and reads the response, returning conn to the
+// pool on success and closing it otherwise. It reports whether any of the
+// message was written.
+func (p *Pool) exchange(ctx context.Context, conn net.Conn, msg *[]byte) (*[]byte, bool, error) {
+	// Abort the exchange when the context ends
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+
+	n, err := conn.Write(*msg)
+	var res []byte
+	if err == nil {
+		res, err = p.framer.Read(conn)
+	}
+	if !stop() || err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, n > 0, ctx.Err()
+		}
+		return nil, n > 0, err
+	}
+
+	p.put(conn)
+	return &res, true, nil
+}
+
+// get returns an idle connection or dials a new one, reporting whether it was idle.
+// Idle connections the host closed meanwhile are dropped.
+func (p *Pool) get(ctx context.Context) (net.Conn, bool, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, false, ErrPoolClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			break
+		}
+		conn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		if conn.wake() {
+			return conn.Conn, true, nil
+		}
+		conn.Close()
+	}
+
+	conn, err := p.dial(ctx)
+	return conn, false, err
+}
+
+// idleConn is a pooled connection whose read is blocked until it is taken,
+// noticing when the host closes it in the meantime.
+type idleConn struct {
+	net.Conn
+	done chan struct{}
+	err  error // result of the blocked read
+}
+
+// watch starts the blocked read of an idle connection.
+func watch(conn net.Conn) *idleConn {
+	c := &idleConn{Conn: conn, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		var b [1]byte
+		_, c.err = conn.Read(b[:])
+	}()
+	return c
+}
+
+// wake interrupts the blocked read and reports whether the connection is still
+// usable. The host sends nothing between exchanges, so a read that returned by
+// itself means it closed the connection or broke the protocol.
+func (c *idleConn) wake() bool {
+	if err := c.SetReadDeadline(time.Now()); err != nil {
+		return false
+	}
+	<-c.done
+	var ne net.Error
+	if !errors.As(c.err, &ne) || !ne.Timeout() {
+		return false
+	}
+	return c.SetReadDeadline(time.Time{}) == nil
+}
+
+// put returns a healthy connection to the pool, closing it if the pool is full.
+func (p *Pool) put(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || len(p.idle) >= p.size {
+		conn.Close()
+		return
+	}
+	p.idle = append(p.idle, watch(conn))
+}
+
+// CloseIdle closes the idle connections, e.g. once the forward host changed,
+// so that the next exchanges dial anew.
+func (p *Pool) CloseIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, conn := range p.idle {
+		conn.Close()
+	}
+	p.idle = nil
+}
+
+// Close closes the idle connections; connections in use are closed when returned.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, conn := range p.idle {
+		conn.Close()
+	}
+	p.idle = nil
+}
@@ -0,0 +1,165 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+// startHost starts a forward host that echoes messages, or stays silent,
+// and counts accepted connections.
+func startHost(t *testing.T, silent bool, accepted *atomic.Int32) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer c.Close()
+				if silent {
+					io.Copy(io.Discard, c)
+					return
+				}
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestPool(t *testing.T) {
+	var accepted atomic.Int32
+	pool := NewPool(startHost(t, false, &accepted), framing.Default, 2, time.Second)
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		msg := framing.Default.Frame([]byte("<XML><STAN>1</STAN></XML>"))
+		res, err := pool.Forward(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("Forward() error = %v", err)
+		}
+		if string(*res) != string(*msg) {
+			t.Errorf("Forward() = %s, want %s", *res, *msg)
+		}
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("connections = %d, want 1 reused connection", n)
+	}
+
+	pool.Close()
+	if _, err := pool.Forward(context.Background(), framing.Default.Frame([]byte("x"))); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Forward() after Close error = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestPoolTimeout(t *testing.T) {
+	var accepted atomic.Int32
+	pool := NewPool(startHost(t, true, &accepted), framing.Default, 2, 50*time.Millisecond)
+	defer pool.Close()
+
+	_, err := pool.Forward(context.Background(), framing.Default.Frame([]byte("x")))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Forward() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestPoolCloseIdle(t *testing.T) {
+	var accepted atomic.Int32
+	pool := NewPool(startHost(t, false, &accepted), framing.Default, 2, time.Second)
+	defer pool.Close()
+
+	for range 2 {
+		if _, err := pool.Forward(context.Background(), framing.Default.Frame([]byte("x"))); err != nil {
+			t.Fatalf("Forward() error = %v", err)
+		}
+		pool.CloseIdle()
+	}
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("connections = %d, want a new connection after CloseIdle", n)
+	}
+}
+
+func TestPoolClosedConnection(t *testing.T) {
+	// startOneShot starts a forward host answering the first message of each
+	// connection and closing it on the next one, after reading it when read is set
+	startOneShot := func(t *testing.T, read bool, accepted, received *atomic.Int32) string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				accepted.Add(1)
+				go func() {
+					defer c.Close()
+					msg, err := framing.Default.Read(c)
+					if err != nil {
+						return
+					}
+					received.Add(1)
+					c.Write(msg)
+					if !read {
+						return
+					}
+					if _, err := framing.Default.Read(c); err == nil {
+						received.Add(1)
+					}
+				}()
+			}
+		}()
+		return l.Addr().String()
+	}
+
+	t.Run("closed while idle", func(t *testing.T) {
+		var accepted, received atomic.Int32
+		pool := NewPool(startOneShot(t, false, &accepted, &received), framing.Default, 2, time.Second)
+		defer pool.Close()
+
+		for i := range 2 {
+			if _, err := pool.Forward(context.Background(), framing.Default.Frame([]byte("x"))); err != nil {
+				t.Fatalf("Forward() %d error = %v", i+1, err)
+			}
+			// Let the host's close arrive before the connection is reused
+			time.Sleep(20 * time.Millisecond)
+		}
+		if n := accepted.Load(); n != 2 {
+			t.Errorf("connections = %d, want the closed connection replaced", n)
+		}
+	})
+
+	t.Run("closed after receiving", func(t *testing.T) {
+		var accepted, received atomic.Int32
+		pool := NewPool(startOneShot(t, true, &accepted, &received), framing.Default, 2, time.Second)
+		defer pool.Close()
+
+		if _, err := pool.Forward(context.Background(), framing.Default.Frame([]byte("x"))); err != nil {
+			t.Fatalf("Forward() error = %v", err)
+		}
+		if _, err := pool.Forward(context.Background(), framing.Default.Frame([]byte("y"))); err == nil {
+			t.Error("Forward() succeeded, want the unanswered message to fail")
+		}
+		time.Sleep(20 * time.Millisecond)
+		if n := received.Load(); n != 2 {
+			t.Errorf("messages received = %d, want 2 without a second posting", n)
+		}
+	})
+}
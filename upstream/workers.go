@@ -0,0 +1,183 @@
+// Package upstream sends messages to the forward TCP host and the customer
+// HTTP API, and provides the channel workers connecting them to a client.
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/andrei-cloud/netfwd/framing"
+)
+
+// Forward sends a message to a destination connection and reads the response.
+// Responses without a length prefix are read a byte at a time unless dest
+// reads through a buffer.
+func Forward(dest io.ReadWriter, f framing.Framer, b *[]byte) (*[]byte, error) {
+	if _, err := dest.Write(*b); err != nil {
+		return nil, err
+	}
+
+	res, err := f.Read(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// ProxyWorker forwards messages to a remote TCP endpoint and returns responses.
+// It releases each frame once it was written, so the sender must not use a
+// frame after handing it over, even when it stops waiting for the response.
+func ProxyWorker(
+	ctx context.Context,
+	inMsg <-chan *framing.Frame,
+	remote net.Conn,
+	f framing.Framer,
+	errCh chan error,
+) chan *[]byte {
+	outMsg := make(chan *[]byte, 1)
+
+	// The worker is the only reader of remote, so responses are read through a buffer
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{bufio.NewReader(remote), remote}
+
+	go func() {
+		defer close(outMsg)
+		for {
+			select {
+			case fr, ok := <-inMsg:
+				if !ok {
+					slog.Info("ProxyWorker: input channel closed")
+					return
+				}
+
+				message := fr.Bytes()
+				res, err := Forward(conn, f, &message)
+				fr.Release()
+				if err != nil {
+					slog.Error("ProxyWorker: forwarding error", "error", err)
+					select {
+					case errCh <- err:
+					case <-ctx.Done():
+					}
+					continue
+				}
+
+				outMsg <- res
+
+			case <-ctx.Done():
+				slog.Info("ProxyWorker: context canceled")
+				return
+			}
+		}
+	}()
+
+	return outMsg
+}
+
+// APIWorker processes messages through the HTTP API.
+func APIWorker(
+	ctx context.Context,
+	api *API,
+	inMsg <-chan *[]byte,
+	f framing.Framer,
+	outErr chan<- error,
+) chan *[]byte {
+	outMsg := make(chan *[]byte, 1)
+
+	go func() {
+		defer close(outMsg)
+		for {
+			select {
+			case message, ok := <-inMsg:
+				if !ok {
+					slog.Info("APIWorker: input channel closed")
+					return
+				}
+
+				res, err := api.Handle(ctx, f, message)
+				if err != nil {
+					slog.Error("APIWorker: API processing error", "error", err)
+					select {
+					case outErr <- err:
+					case <-ctx.Done():
+					}
+					continue
+				}
+
+				outMsg <- res
+
+			case <-ctx.Done():
+				slog.Info("APIWorker: context canceled")
+				return
+			}
+		}
+	}()
+
+	return outMsg
+}
+
+// SourceSenderWorker sends responses back to the original client.
+func SourceSenderWorker(
+	ctx context.Context,
+	inMsg <-chan *[]byte,
+	w io.Writer,
+	errCh chan<- error,
+) {
+	for {
+		select {
+		case message, ok := <-inMsg:
+			if !ok {
+				slog.Info("SourceSenderWorker: input channel closed")
+				return
+			}
+
+			if _, err := w.Write(*message); err != nil {
+				slog.Error("SourceSenderWorker: write error", "error", err)
+				select {
+				case errCh <- err:
+				case <-ctx.Done():
+				}
+			}
+
+		case <-ctx.Done():
+			slog.Info("SourceSenderWorker: context canceled")
+			return
+		}
+	}
+}
+
+// FanIn combines multiple channels into a single channel
+func FanIn(ctx context.Context, channels ...<-chan *[]byte) <-chan *[]byte {
+	var wg sync.WaitGroup
+	multiplexStream := make(chan *[]byte)
+
+	multiplex := func(ctx context.Context, c <-chan *[]byte) {
+		defer wg.Done()
+		for msg := range c {
+			select {
+			case <-ctx.Done():
+				return
+			case multiplexStream <- msg:
+			}
+		}
+	}
+
+	wg.Add(len(channels))
+	for _, channel := range channels {
+		go multiplex(ctx, channel)
+	}
+
+	go func() {
+		wg.Wait()
+		close(multiplexStream)
+	}()
+
+	return multiplexStream
+}
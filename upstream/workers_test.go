@@ -1,4 +1,4 @@
-package main
+package upstream
 
 import (
 	"context"
@@ -6,6 +6,8 @@ import (
 	"log"
 	"net"
 	"testing"
+
+	"github.com/andrei-cloud/netfwd/framing"
 )
 
 func setupRemote() context.CancelFunc {
@@ -110,13 +112,13 @@ func BenchmarkPassThroughWorker(b *testing.B) {
 			if err != nil {
 				b.Fatal(err)
 			}
-			inMsg := make(chan *[]byte, 1)
+			inMsg := make(chan *framing.Frame, 1)
 			errCh := make(chan error)
-			outMsg := ProxyWorker(ctx, inMsg, remote, errCh)
+			outMsg := ProxyWorker(ctx, inMsg, remote, framing.Default, errCh)
 
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				inMsg <- &tt.msg
+				inMsg <- framing.Default.Wrap(tt.msg)
 				<-outMsg
 				<-errCh
 			}